@@ -204,7 +204,8 @@ func (a *Application) Start(name string, arguments []string, router *web.Router,
 	return a.StartServers(name, serviceCheckers)
 }
 
-// Start spawns the HTTP and Monitoring servers or run migrations if the first argument is "migrate"
+// Start spawns the HTTP and Monitoring servers or run migrations if the first argument is "migrate".
+// The remaining arguments are forwarded to database.RunMigrationCommand (e.g. "migrate status")
 // Deprecated: This function should no longer be used. Use the API servers instead.
 func (c *ClassicalApplication) Start(name string, arguments []string, router *web.Router, metricViews []*metrics.View, serviceCheckers []web.HealthzChecker, migrations []darwin.Migration) error {
 	var command string
@@ -219,13 +220,14 @@ func (c *ClassicalApplication) Start(name string, arguments []string, router *we
 
 	switch command {
 	case "migrate":
-		return c.StartMigrations(migrations)
+		return database.RunMigrationCommand(c.Database, database.FromDarwinMigrations(migrations), arguments, database.MigrationOptions{Logger: c.Logger})
 	default:
 		return c.Application.Start(name, arguments, router, metricViews, serviceCheckers)
 	}
 }
 
-// Start spawns the HTTP and Monitoring servers or run migrations if the first argument is "migrate"
+// Start spawns the HTTP and Monitoring servers or run migrations if the first argument is "migrate".
+// The remaining arguments are forwarded to database.RunMigrationCommand (e.g. "migrate status")
 // Deprecated: This function should no longer be used. Use the API servers instead.
 func (c *CQRSApplication) Start(name string, arguments []string, router *web.Router, metricViews []*metrics.View, serviceCheckers []web.HealthzChecker, migrations []darwin.Migration) error {
 	var command string
@@ -240,7 +242,7 @@ func (c *CQRSApplication) Start(name string, arguments []string, router *web.Rou
 
 	switch command {
 	case "migrate":
-		return c.StartMigrations(migrations)
+		return database.RunMigrationCommand(c.WriteDatabase, database.FromDarwinMigrations(migrations), arguments, database.MigrationOptions{Logger: c.Logger})
 	default:
 		return c.Application.Start(name, arguments, router, metricViews, serviceCheckers)
 	}
@@ -249,13 +251,13 @@ func (c *CQRSApplication) Start(name string, arguments []string, router *web.Rou
 // StartMigrations runs the migrations
 // Deprecated: This function should no longer be used. Use the API servers instead.
 func (c *ClassicalApplication) StartMigrations(migrations []darwin.Migration) error {
-	return database.Migrate(c.Database, migrations)
+	return database.MigrateWithOptions(c.Database, database.FromDarwinMigrations(migrations), database.MigrationOptions{Logger: c.Logger})
 }
 
 // StartMigrations runs the migrations
 // Deprecated: This function should no longer be used. Use the API servers instead.
 func (c *CQRSApplication) StartMigrations(migrations []darwin.Migration) error {
-	return database.Migrate(c.WriteDatabase, migrations)
+	return database.MigrateWithOptions(c.WriteDatabase, database.FromDarwinMigrations(migrations), database.MigrationOptions{Logger: c.Logger})
 }
 
 // StartServers spawns the HTTP and Monitoring server
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+const (
+	// AuditLogTable is the table the audit triggers write to
+	AuditLogTable = "audit_log"
+	// AuditTraceIDSetting is the setting holding the trace ID recorded in the audit log. The actor is read from the
+	// UserIDSetting.
+	AuditTraceIDSetting = "app.trace_id"
+	// DefaultAuditIDColumn is the column identifying the audited entities when the migration does not specify one
+	DefaultAuditIDColumn = "id"
+)
+
+// AuditEntry is a write recorded in the audit log. Table is qualified with its schema, e.g. `public.orders`. OldValues is the JSON `null` for an insert and NewValues for a
+// delete. Actor and TraceID are empty when the write was made without the matching session settings.
+type AuditEntry struct {
+	ID        int64           `db:"id"`
+	Table     string          `db:"table_name"`
+	EntityID  string          `db:"entity_id"`
+	Operation string          `db:"operation"`
+	Actor     string          `db:"actor"`
+	TraceID   string          `db:"trace_id"`
+	OldValues json.RawMessage `db:"old_values"`
+	NewValues json.RawMessage `db:"new_values"`
+	ChangedAt time.Time       `db:"changed_at"`
+}
+
+// AuditLogMigration creates the audit log table and the trigger function recording the writes. It must be applied
+// before the AuditTableMigration of any table. Auditing relies on Postgres triggers and is not available with the
+// other dialects.
+func AuditLogMigration(version float64) Migration {
+	return Migration{
+		Version:     version,
+		Description: "Create the audit log",
+		Script: fmt.Sprintf(`
+			CREATE TABLE %[1]s (
+				id BIGSERIAL PRIMARY KEY,
+				table_name TEXT NOT NULL,
+				entity_id TEXT NOT NULL,
+				operation TEXT NOT NULL,
+				actor TEXT,
+				trace_id TEXT,
+				old_values JSONB,
+				new_values JSONB,
+				changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+			);
+
+			CREATE INDEX %[1]s_entity_idx ON %[1]s (table_name, entity_id, changed_at);
+
+			CREATE FUNCTION %[1]s_record() RETURNS TRIGGER AS $$
+			DECLARE
+				row_values JSONB;
+			BEGIN
+				IF TG_OP = 'DELETE' THEN
+					row_values := to_jsonb(OLD);
+				ELSE
+					row_values := to_jsonb(NEW);
+				END IF;
+
+				INSERT INTO %[1]s (table_name, entity_id, operation, actor, trace_id, old_values, new_values)
+				VALUES (
+					TG_TABLE_SCHEMA || '.' || TG_TABLE_NAME,
+					row_values ->> TG_ARGV[0],
+					TG_OP,
+					NULLIF(current_setting(%[2]s, true), ''),
+					NULLIF(current_setting(%[3]s, true), ''),
+					CASE WHEN TG_OP = 'INSERT' THEN NULL ELSE to_jsonb(OLD) END,
+					CASE WHEN TG_OP = 'DELETE' THEN NULL ELSE to_jsonb(NEW) END
+				);
+
+				RETURN NULL;
+			END;
+			$$ LANGUAGE plpgsql`, AuditLogTable, pq.QuoteLiteral(UserIDSetting), pq.QuoteLiteral(AuditTraceIDSetting)),
+		DownScript: fmt.Sprintf(`
+			DROP FUNCTION %[1]s_record();
+			DROP TABLE %[1]s`, AuditLogTable),
+	}
+}
+
+// AuditTableMigration opts a table in the audit log: every insert, update and delete of its rows is recorded.
+// The table may be qualified with its schema, e.g. `sales.orders`. idColumn identifies the audited entity and
+// defaults to DefaultAuditIDColumn.
+func AuditTableMigration(version float64, table string, idColumn string) Migration {
+	if idColumn == "" {
+		idColumn = DefaultAuditIDColumn
+	}
+
+	// a trigger belongs to its table and its name can't be qualified with a schema
+	parts := strings.Split(table, ".")
+	trigger := pq.QuoteIdentifier(parts[len(parts)-1] + "_audit")
+	quotedTable := PostgresDialect{}.QuoteIdentifier(table)
+
+	return Migration{
+		Version:     version,
+		Description: fmt.Sprintf("Audit the %s table", table),
+		Script: fmt.Sprintf(`
+			CREATE TRIGGER %s
+			AFTER INSERT OR UPDATE OR DELETE ON %s
+			FOR EACH ROW EXECUTE PROCEDURE %s_record(%s)`, trigger, quotedTable, AuditLogTable, pq.QuoteLiteral(idColumn)),
+		DownScript: fmt.Sprintf(`DROP TRIGGER %s ON %s`, trigger, quotedTable),
+	}
+}
+
+// AuditHistory returns the writes recorded for an entity of a table, from the oldest to the newest. A table which is
+// not qualified with its schema is looked up in the current schema.
+func AuditHistory(ctx context.Context, db ReadDB, table string, entityID string) ([]AuditEntry, error) {
+	statement := sqlx.Rebind(sqlx.BindType(db.Dialect().DriverName()), fmt.Sprintf(`
+		SELECT
+			id, table_name, entity_id, operation, COALESCE(actor, '') AS actor, COALESCE(trace_id, '') AS trace_id,
+			COALESCE(old_values, 'null'::jsonb) AS old_values, COALESCE(new_values, 'null'::jsonb) AS new_values, changed_at
+		FROM %s
+		WHERE table_name IN (?, current_schema() || '.' || ?) AND entity_id = ?
+		ORDER BY changed_at, id`, AuditLogTable))
+
+	var entries []AuditEntry
+	if err := db.SelectContext(ctx, &entries, statement, table, table, entityID); err != nil {
+		return nil, fmt.Errorf("can't select the audit history of %s %s: %v", table, entityID, err)
+	}
+
+	return entries, nil
+}
+
+// WithTraceID returns a copy of the context holding the trace ID recorded in the audit log
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	return WithSessionSettings(ctx, SessionSettings{AuditTraceIDSetting: traceID})
+}
+
+// AuditMiddleware adds the trace ID of the request to the session settings so that it is recorded in the audit log.
+// The actor is the UserIDSetting, usually added by a SessionMiddleware.
+func AuditMiddleware() web.Middleware {
+	return func(before web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			if v, ok := ctx.Value(web.KeyValues).(*web.Values); ok && v.TraceID != "" {
+				ctx = WithTraceID(ctx, v.TraceID)
+			}
+
+			return before(ctx, w, r.WithContext(ctx), params)
+		}
+
+		return h
+	}
+}
@@ -0,0 +1,312 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"github.com/fewlinesco/go-pkg/platform/metrics"
+)
+
+var copyLineRegex = regexp.MustCompile(`COPY [^,]+, line (\d+)`)
+
+// BulkRows are rows given as lists of values, in the order of the columns
+type BulkRows struct {
+	Columns []string
+	Values  [][]interface{}
+}
+
+// BulkInsertError reports the row of a bulk insert which could not be inserted. Row is the index of the row in the
+// inserted slice.
+type BulkInsertError struct {
+	Row int
+	Err error
+}
+
+func (e *BulkInsertError) Error() string {
+	return fmt.Sprintf("can't insert row %d: %v", e.Row, e.Err)
+}
+
+// Unwrap returns the error reported by the driver
+func (e *BulkInsertError) Unwrap() error {
+	return e.Err
+}
+
+// bulkSource gives access to the values of the rows to insert
+type bulkSource struct {
+	columns []string
+	length  int
+	row     func(i int) []interface{}
+}
+
+// newBulkSource reads the rows of a bulk insert, either BulkRows or a slice of structs (or pointers to structs) whose
+// columns are mapped with the `db` struct tags like sqlx does
+func newBulkSource(rows interface{}) (bulkSource, error) {
+	if bulkRows, ok := rows.(BulkRows); ok {
+		for i, values := range bulkRows.Values {
+			if len(values) != len(bulkRows.Columns) {
+				return bulkSource{}, &BulkInsertError{Row: i, Err: fmt.Errorf("expected %d values but got %d", len(bulkRows.Columns), len(values))}
+			}
+		}
+
+		return bulkSource{
+			columns: bulkRows.Columns,
+			length:  len(bulkRows.Values),
+			row:     func(i int) []interface{} { return bulkRows.Values[i] },
+		}, nil
+	}
+
+	slice := reflect.ValueOf(rows)
+	if slice.Kind() != reflect.Slice {
+		return bulkSource{}, fmt.Errorf("can't bulk insert a %T: expected BulkRows or a slice of structs", rows)
+	}
+
+	elementType := slice.Type().Elem()
+	pointers := elementType.Kind() == reflect.Ptr
+	if pointers {
+		elementType = elementType.Elem()
+	}
+
+	if elementType.Kind() != reflect.Struct {
+		return bulkSource{}, fmt.Errorf("can't bulk insert a %T: expected BulkRows or a slice of structs", rows)
+	}
+
+	columns, indexes := structColumns(elementType, nil)
+	if len(columns) == 0 {
+		return bulkSource{}, fmt.Errorf("can't bulk insert a %T: the structs have no column", rows)
+	}
+
+	return bulkSource{
+		columns: columns,
+		length:  slice.Len(),
+		row: func(i int) []interface{} {
+			element := slice.Index(i)
+			if pointers {
+				element = element.Elem()
+			}
+
+			values := make([]interface{}, len(indexes))
+			for j, index := range indexes {
+				values[j] = element.FieldByIndex(index).Interface()
+			}
+
+			return values
+		},
+	}, nil
+}
+
+// structColumns lists the columns of the exported fields of a struct, the fields of the untagged embedded structs
+// included. Fields tagged with `db:"-"` are skipped.
+func structColumns(structType reflect.Type, parent []int) ([]string, [][]int) {
+	var (
+		columns []string
+		indexes [][]int
+	)
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		index := append(append([]int{}, parent...), i)
+
+		tag := strings.Split(field.Tag.Get("db"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			embeddedColumns, embeddedIndexes := structColumns(field.Type, index)
+			columns = append(columns, embeddedColumns...)
+			indexes = append(indexes, embeddedIndexes...)
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if tag == "" {
+			tag = strings.ToLower(field.Name)
+		}
+
+		columns = append(columns, tag)
+		indexes = append(indexes, index)
+	}
+
+	return columns, indexes
+}
+
+// bulkInsert streams the rows with COPY FROM STDIN on Postgres, and with a prepared INSERT on the other engines
+func bulkInsert(ctx context.Context, tx *sqlx.Tx, dialect Dialect, table string, rows interface{}) (int64, error) {
+	source, err := newBulkSource(rows)
+	if err != nil {
+		return 0, err
+	}
+
+	if source.length == 0 {
+		return 0, nil
+	}
+
+	var inserted int64
+	if dialect.DriverName() == (PostgresDialect{}).DriverName() {
+		inserted, err = copyIn(ctx, tx, table, source)
+	} else {
+		inserted, err = insertEach(ctx, tx, dialect, table, source)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.Record(ctx, metricBulkInsertRows.Measure(float64(inserted)))
+
+	return inserted, nil
+}
+
+func copyIn(ctx context.Context, tx *sqlx.Tx, table string, source bulkSource) (int64, error) {
+	statement := pq.CopyIn(table, source.columns...)
+	if parts := strings.SplitN(table, ".", 2); len(parts) == 2 {
+		statement = pq.CopyInSchema(parts[0], parts[1], source.columns...)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, statement)
+	if err != nil {
+		return 0, fmt.Errorf("can't prepare the bulk insert into %s: %w", table, err)
+	}
+	defer stmt.Close()
+
+	for i := 0; i < source.length; i++ {
+		if _, err := stmt.ExecContext(ctx, source.row(i)...); err != nil {
+			return 0, copyError(err, i)
+		}
+	}
+
+	// the rows are buffered by lib/pq, the last exec flushes them and reports the errors of the server
+	result, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, copyError(err, -1)
+	}
+
+	return result.RowsAffected()
+}
+
+// copyError finds the row an error of a COPY refers to. The server reports errors asynchronously, with the line of the
+// offending row, so that an error returned while sending a row can be about a previous one.
+func copyError(err error, row int) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if matches := copyLineRegex.FindStringSubmatch(pqErr.Where); matches != nil {
+			if line, convErr := strconv.Atoi(matches[1]); convErr == nil {
+				row = line - 1
+			}
+		}
+	}
+
+	if row < 0 {
+		return fmt.Errorf("can't bulk insert: %w", err)
+	}
+
+	return &BulkInsertError{Row: row, Err: err}
+}
+
+func insertEach(ctx context.Context, tx *sqlx.Tx, dialect Dialect, table string, source bulkSource) (int64, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(source.columns)), ", ")
+	statement := sqlx.Rebind(sqlx.BindType(dialect.DriverName()), fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(source.columns, ", "), placeholders))
+
+	stmt, err := tx.PrepareContext(ctx, statement)
+	if err != nil {
+		return 0, fmt.Errorf("can't prepare the bulk insert into %s: %w", table, err)
+	}
+	defer stmt.Close()
+
+	for i := 0; i < source.length; i++ {
+		if _, err := stmt.ExecContext(ctx, source.row(i)...); err != nil {
+			return 0, &BulkInsertError{Row: i, Err: err}
+		}
+	}
+
+	return int64(source.length), nil
+}
+
+// BulkInsertContext inserts the rows in a single transaction, which is rolled back when a row can't be inserted. The
+// rows are either BulkRows or a slice of structs whose columns are mapped with the `db` struct tags. A row error is
+// reported as a *BulkInsertError.
+func (db *prodDB) BulkInsertContext(ctx context.Context, table string, rows interface{}) (int64, error) {
+	var (
+		inserted int64
+		err      error
+	)
+
+	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
+		var tx *sqlx.Tx
+		if tx, err = db.db.BeginTxx(ctx, nil); err != nil {
+			return
+		}
+
+		prodTx := &prodTx{tx: tx, dialect: db.dialect, timeouts: db.timeouts, settings: make(SessionSettings)}
+		if err = prodTx.applySessionSettings(ctx); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		if inserted, err = bulkInsert(ctx, tx, db.dialect, table, rows); err != nil {
+			tx.Rollback()
+			return
+		}
+
+		err = tx.Commit()
+	})
+
+	metrics.RecordError(ctx, metricQueryErrorTotal, err)
+
+	return inserted, err
+}
+
+// BulkInsertContext same as db.BulkInsertContext but for the current transaction
+func (tx *prodTx) BulkInsertContext(ctx context.Context, table string, rows interface{}) (int64, error) {
+	var (
+		inserted int64
+		err      error
+	)
+
+	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
+		if err = tx.applySessionSettings(ctx); err != nil {
+			return
+		}
+
+		inserted, err = bulkInsert(ctx, tx.tx, tx.dialect, table, rows)
+	})
+
+	metrics.RecordError(ctx, metricQueryErrorTotal, err)
+
+	return inserted, err
+}
+
+// BulkInsertContext runs the bulk insert in a savepoint so that a failure does not abort the sandbox transaction
+func (db *sandboxDB) BulkInsertContext(ctx context.Context, table string, rows interface{}) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	inserted, err := tx.(*sandboxTx).BulkInsertContext(ctx, table, rows)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	return inserted, tx.Commit()
+}
+
+func (tx *sandboxTx) BulkInsertContext(ctx context.Context, table string, rows interface{}) (int64, error) {
+	if err := tx.applySessionSettings(ctx); err != nil {
+		return 0, err
+	}
+
+	return bulkInsert(ctx, tx.tx, tx.db.dialect, table, rows)
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CredentialsCheckInterval is the minimum time between two checks of the credentials files
+var CredentialsCheckInterval = time.Second
+
+var envReferenceRegex = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// expandEnv replaces the values written as `${NAME}` by the NAME environment variable
+func expandEnv(config Config) Config {
+	expand := func(value string) string {
+		matches := envReferenceRegex.FindStringSubmatch(value)
+		if matches == nil {
+			return value
+		}
+
+		return os.Getenv(matches[1])
+	}
+
+	config.URL = expand(config.URL)
+	config.Driver = expand(config.Driver)
+	config.Scheme = expand(config.Scheme)
+	config.Host = expand(config.Host)
+	config.Username = expand(config.Username)
+	config.UsernameFile = expand(config.UsernameFile)
+	config.Password = expand(config.Password)
+	config.PasswordFile = expand(config.PasswordFile)
+	config.Database = expand(config.Database)
+
+	if len(config.Options) > 0 {
+		options := make(map[string]string, len(config.Options))
+		for key, value := range config.Options {
+			options[key] = expand(value)
+		}
+		config.Options = options
+	}
+
+	return config
+}
+
+// credentialsConnector opens the connections with the credentials currently written in the credentials files. When
+// the files change, the connections opened with the previous credentials are closed as soon as they are back in the
+// pool so that the running queries are not interrupted.
+type credentialsConnector struct {
+	config  Config
+	dialect Dialect
+	driver  driver.Driver
+
+	mutex       sync.Mutex
+	credentials Config
+	modTimes    [2]time.Time
+	lastCheck   time.Time
+	generation  uint64
+}
+
+func newCredentialsConnector(config Config, dialect Dialect) (*credentialsConnector, error) {
+	// the driver registered by database/sql is only reachable through a connection pool
+	db, err := sql.Open(config.Driver, "")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	connector := &credentialsConnector{
+		config:  config,
+		dialect: dialect,
+		driver:  db.Driver(),
+	}
+
+	if _, err := connector.refresh(true); err != nil {
+		return nil, err
+	}
+
+	return connector, nil
+}
+
+// refresh reads the credentials files again if they changed since the last read. Unless forced, the files are
+// checked at most once per CredentialsCheckInterval.
+func (connector *credentialsConnector) refresh(force bool) (Config, error) {
+	connector.mutex.Lock()
+	defer connector.mutex.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(connector.lastCheck) < CredentialsCheckInterval {
+		return connector.credentials, nil
+	}
+	connector.lastCheck = now
+
+	var modTimes [2]time.Time
+	for i, file := range []string{connector.config.UsernameFile, connector.config.PasswordFile} {
+		if file == "" {
+			continue
+		}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			return connector.credentials, fmt.Errorf("can't read the database credentials: %v", err)
+		}
+
+		modTimes[i] = info.ModTime()
+	}
+
+	if !force && modTimes == connector.modTimes {
+		return connector.credentials, nil
+	}
+
+	credentials := connector.config
+
+	if credentials.UsernameFile != "" {
+		username, err := os.ReadFile(credentials.UsernameFile)
+		if err != nil {
+			return connector.credentials, fmt.Errorf("can't read the database username: %v", err)
+		}
+		credentials.Username = strings.TrimSpace(string(username))
+	}
+
+	if credentials.PasswordFile != "" {
+		password, err := os.ReadFile(credentials.PasswordFile)
+		if err != nil {
+			return connector.credentials, fmt.Errorf("can't read the database password: %v", err)
+		}
+		credentials.Password = strings.TrimSpace(string(password))
+	}
+
+	if credentials.URL != "" {
+		var err error
+		if credentials.URL, err = withURLCredentials(credentials); err != nil {
+			return connector.credentials, err
+		}
+	}
+
+	if !force {
+		atomic.AddUint64(&connector.generation, 1)
+	}
+
+	connector.credentials = credentials
+	connector.modTimes = modTimes
+
+	return credentials, nil
+}
+
+// Connect opens a connection with the current credentials
+func (connector *credentialsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	credentials, err := connector.refresh(false)
+	if err != nil {
+		return nil, err
+	}
+
+	generation := atomic.LoadUint64(&connector.generation)
+	dataSourceName := connector.dialect.DataSourceName(credentials)
+
+	var conn driver.Conn
+	if tlsConnector := newTLSConnector(credentials, dataSourceName); tlsConnector != nil {
+		conn, err = tlsConnector.Connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else if driverContext, ok := connector.driver.(driver.DriverContext); ok {
+		c, err := driverContext.OpenConnector(dataSourceName)
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err = c.Connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		conn, err = connector.driver.Open(dataSourceName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &credentialsConn{Conn: conn, connector: connector, generation: generation}, nil
+}
+
+// Driver returns the underlying driver
+func (connector *credentialsConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// credentialsConn is a connection which becomes invalid once the credentials it has been opened with are rotated
+type credentialsConn struct {
+	driver.Conn
+	connector  *credentialsConnector
+	generation uint64
+}
+
+// IsValid is called by database/sql before putting a connection back in the pool
+func (conn *credentialsConn) IsValid() bool {
+	if conn.stale() {
+		return false
+	}
+
+	if validator, ok := conn.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+
+	return true
+}
+
+// ResetSession is called by database/sql before reusing a connection of the pool. A connection opened with rotated
+// credentials is reported as bad so that database/sql opens a new one instead.
+func (conn *credentialsConn) ResetSession(ctx context.Context) error {
+	if conn.stale() {
+		return driver.ErrBadConn
+	}
+
+	if resetter, ok := conn.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+// stale reports whether the credentials have been rotated since the connection has been opened. A failure to read
+// the files keeps the current connections.
+func (conn *credentialsConn) stale() bool {
+	if _, err := conn.connector.refresh(false); err != nil {
+		return false
+	}
+
+	return conn.generation != atomic.LoadUint64(&conn.connector.generation)
+}
+
+func (conn *credentialsConn) Ping(ctx context.Context) error {
+	if pinger, ok := conn.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+func (conn *credentialsConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := conn.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+
+	return conn.Conn.Prepare(query)
+}
+
+func (conn *credentialsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := conn.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+
+	if opts.ReadOnly || opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, fmt.Errorf("the %s driver does not support transaction options", conn.connector.config.Driver)
+	}
+
+	return conn.Conn.Begin()
+}
+
+func (conn *credentialsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := conn.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, query, args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+func (conn *credentialsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := conn.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, query, args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+func (conn *credentialsConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := conn.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+
+	return driver.ErrSkip
+}
+
+// withURLCredentials writes the credentials read from the files in the userinfo of the URL, the URL keeps its own
+// username or password when only one of the files is defined
+func withURLCredentials(config Config) (string, error) {
+	parsed, err := url.Parse(config.URL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		// the URL is not part of the error, it may hold a password
+		return "", fmt.Errorf("can't use the credentials files with an URL which is not of the form scheme://host")
+	}
+
+	username := config.Username
+	if config.UsernameFile == "" {
+		username = parsed.User.Username()
+	}
+
+	password, hasPassword := parsed.User.Password()
+	if config.PasswordFile != "" {
+		password, hasPassword = config.Password, true
+	}
+
+	switch {
+	case hasPassword:
+		parsed.User = url.UserPassword(username, password)
+	case username != "":
+		parsed.User = url.User(username)
+	}
+
+	return parsed.String(), nil
+}
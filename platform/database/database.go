@@ -13,20 +13,34 @@ import (
 	"github.com/fewlinesco/go-pkg/platform/web"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
 )
 
 // Config represents the database configuration that can be defined / overridden by the application.
+// Any string value written as `${NAME}` is replaced by the NAME environment variable when connecting.
+// UsernameFile and PasswordFile take precedence over Username and Password: the files are read again whenever they
+// change so that rotated credentials are used by the new connections. With an URL, they replace its userinfo, which
+// requires an URL of the form scheme://host.
+// StatementTimeout and MaxStatementTimeout are expressed in milliseconds. StatementTimeout applies to the statements
+// run with a context without deadline, the others are limited to the time left before the deadline. No statement can
+// run for longer than MaxStatementTimeout. A value of 0 disables the limit. They are only supported by Postgres.
+// TLS configures the encryption of the connections, it is validated when connecting.
 type Config struct {
-	URL      string            `json:"url"`
-	Driver   string            `json:"driver"`
-	Scheme   string            `json:"scheme"`
-	Host     string            `json:"host"`
-	Port     int               `json:"port"`
-	Username string            `json:"username"`
-	Password string            `json:"password"`
-	Database string            `json:"database"`
-	Options  map[string]string `json:"options"`
+	URL          string            `json:"url"`
+	Driver       string            `json:"driver"`
+	Scheme       string            `json:"scheme"`
+	Host         string            `json:"host"`
+	Port         int               `json:"port"`
+	Username     string            `json:"username"`
+	UsernameFile string            `json:"username_file"`
+	Password     string            `json:"password"`
+	PasswordFile string            `json:"password_file"`
+	Database     string            `json:"database"`
+	Options      map[string]string `json:"options"`
+
+	StatementTimeout    int `json:"statement_timeout"`
+	MaxStatementTimeout int `json:"max_statement_timeout"`
+
+	TLS TLSConfig `json:"tls"`
 }
 
 // DefaultConfig are the default values for any application
@@ -43,6 +57,7 @@ var DefaultConfig = Config{
 var (
 	metricQueryLatencyMs  = metrics.Float64("sql_query_latency_ms", "The query latency in milliseconds", metrics.UnitMilliseconds)
 	metricQueryErrorTotal = metrics.Float64("sql_query_error_total", "The query error total", metrics.UnitDimensionless)
+	metricBulkInsertRows  = metrics.Float64("sql_bulk_insert_rows", "The number of rows inserted by bulk inserts", metrics.UnitDimensionless)
 )
 
 // MetricViews are the generic metrics generated for any datbase based applications
@@ -59,6 +74,12 @@ var MetricViews = []*metrics.View{
 		Description: "The number of errors",
 		Aggregation: metrics.ViewCount(),
 	},
+	{
+		Name:        "sql/bulk_insert_rows",
+		Measure:     metricBulkInsertRows,
+		Description: "The number of rows inserted by bulk inserts",
+		Aggregation: metrics.ViewSum(),
+	},
 }
 
 // WriteDB describes a set of methods which can be performed on a DB with write permissions
@@ -68,8 +89,10 @@ type WriteDB interface {
 	Close() error
 	ExecContext(ctx context.Context, statement string, arg ...interface{}) (sql.Result, error)
 	NamedExecContext(ctx context.Context, statement string, arg interface{}) (sql.Result, error)
+	BulkInsertContext(ctx context.Context, table string, rows interface{}) (int64, error)
 	PingContext(ctx context.Context) error
 	HealthCheck(string) web.HealthzChecker
+	Dialect() Dialect
 }
 
 // ReadDB describes a set of methods which can be performed on a DB with read-only permissions
@@ -82,6 +105,7 @@ type ReadDB interface {
 	GetContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error
 	PingContext(ctx context.Context) error
 	HealthCheck(string) web.HealthzChecker
+	Dialect() Dialect
 }
 
 // DB is a generic interface for database interaction
@@ -91,64 +115,138 @@ type DB interface {
 	Close() error
 	ExecContext(ctx context.Context, statement string, arg ...interface{}) (sql.Result, error)
 	NamedExecContext(ctx context.Context, statement string, arg interface{}) (sql.Result, error)
+	BulkInsertContext(ctx context.Context, table string, rows interface{}) (int64, error)
 	SelectContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error
 	SelectMultipleContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error
 	GetContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error
 	PingContext(ctx context.Context) error
 	HealthCheck(string) web.HealthzChecker
+	Dialect() Dialect
 }
 
 // Tx is a generic interface for database transactions
+// The session settings held by the context of a statement are applied to the transaction before running it.
 type Tx interface {
 	SelectContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error
 	GetContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error
 	ExecContext(ctx context.Context, statement string, arg ...interface{}) (sql.Result, error)
 	NamedExecContext(ctx context.Context, statement string, arg interface{}) (sql.Result, error)
+	BulkInsertContext(ctx context.Context, table string, rows interface{}) (int64, error)
 	Commit() error
 	Rollback() error
+	Dialect() Dialect
 }
 
 // DB represents the database connection
 type prodDB struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	dialect  Dialect
+	timeouts statementTimeouts
 }
 
 // Tx represents a database transaction
 type prodTx struct {
-	tx *sqlx.Tx
+	tx       *sqlx.Tx
+	dialect  Dialect
+	timeouts statementTimeouts
+	// settings are the session settings already applied to the transaction
+	settings SessionSettings
+	// statementDeadline is the deadline the statement timeout of the transaction has been computed from, zero if none
+	statementDeadline time.Time
 }
 
+// NewGenericDriver creates a darwin driver using the given dialect, or the migration dialect of the database if nil
 func (db *prodDB) NewGenericDriver(dialect darwin.Dialect) *darwin.GenericDriver {
-	return darwin.NewGenericDriver(db.db.DB, darwin.PostgresDialect{})
+	if dialect == nil {
+		dialect = db.dialect.MigrationDialect()
+	}
+
+	return darwin.NewGenericDriver(db.db.DB, dialect)
+}
+
+// Dialect returns the dialect of the SQL engine the database is connected to
+func (db *prodDB) Dialect() Dialect {
+	return db.dialect
+}
+
+func connectionURL(config Config) string {
+	if config.URL != "" {
+		return config.URL
+	}
+
+	options := make(url.Values)
+	for key, value := range config.Options {
+		options.Add(key, value)
+	}
+
+	connectionURL := url.URL{
+		Scheme:   config.Scheme,
+		User:     url.UserPassword(config.Username, config.Password),
+		Host:     fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Path:     config.Database,
+		RawQuery: options.Encode(),
+	}
+
+	return connectionURL.String()
+}
+
+func connect(config Config) (*sqlx.DB, Dialect, error) {
+	db, dialect, err := open(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return db, dialect, nil
 }
 
-func connect(config Config) (*sqlx.DB, error) {
-	if config.URL == "" {
-		options := make(url.Values)
-		for key, value := range config.Options {
-			options.Add(key, value)
+// open prepares a connection pool without checking the database is reachable
+func open(config Config) (*sqlx.DB, Dialect, error) {
+	config = expandEnv(config)
+
+	dialect, err := dialectFor(config.Driver)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateTLS(config, dialect); err != nil {
+		return nil, nil, err
+	}
+
+	if config.UsernameFile == "" && config.PasswordFile == "" {
+		dataSourceName := dialect.DataSourceName(config)
+		if connector := newTLSConnector(config, dataSourceName); connector != nil {
+			return sqlx.NewDb(sql.OpenDB(connector), config.Driver), dialect, nil
 		}
 
-		connectionURL := url.URL{
-			Scheme:   config.Scheme,
-			User:     url.UserPassword(config.Username, config.Password),
-			Host:     fmt.Sprintf("%s:%d", config.Host, config.Port),
-			Path:     config.Database,
-			RawQuery: options.Encode(),
+		db, err := sqlx.Open(config.Driver, dataSourceName)
+		if err != nil {
+			return nil, nil, err
 		}
-		config.URL = connectionURL.String()
+
+		return db, dialect, nil
 	}
-	return sqlx.Connect(config.Driver, config.URL)
+
+	connector, err := newCredentialsConnector(config, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sqlx.NewDb(sql.OpenDB(connector), config.Driver), dialect, nil
 }
 
 // Connect configures the driver and opens a database connection
 func Connect(config Config) (DB, error) {
-	db, err := connect(config)
+	db, dialect, err := connect(config)
 	if err != nil {
 		return nil, fmt.Errorf("can't connect to database: %v", err)
 	}
 
-	return &prodDB{db: db}, nil
+	return &prodDB{db: db, dialect: dialect, timeouts: newStatementTimeouts(config)}, nil
 }
 
 // ConnectWriteDatabase creates a new database meant for write operations
@@ -161,54 +259,40 @@ func ConnectReadDatabase(config Config) (ReadDB, error) {
 	return Connect(config)
 }
 
-// IsUniqueConstraintError is a helper checking the current database error and returnning true if it's a PG unique index
+// IsUniqueConstraintError is a helper checking the current database error and returnning true if it's a unique index
 // error for a specific constraint name
 func IsUniqueConstraintError(err error, constraintName string) bool {
-	e, ok := err.(*pq.Error)
-	if !ok {
-		return false
-	}
+	e := Classify(err)
 
-	return e.Code == "23505" && e.Constraint == constraintName
+	return e != nil && e.Kind == ErrorKindUniqueViolation && e.Constraint == constraintName
 }
 
-// IsInsuficientPrivilegeError is a helper checking the current database error and returning true if it's a PG insuficient privilege error
+// IsInsuficientPrivilegeError is a helper checking the current database error and returning true if it's an insuficient privilege error
 func IsInsuficientPrivilegeError(err error) bool {
-	e, ok := err.(*pq.Error)
-	if !ok {
-		return false
-	}
+	e := Classify(err)
 
-	return e.Code == "42501"
+	return e != nil && e.Kind == ErrorKindInsufficientPrivilege
 }
 
-// IsCheckConstraintError is a helper checking the current database error and returning true if it's a PG check constraint error
+// IsCheckConstraintError is a helper checking the current database error and returning true if it's a check constraint error
 func IsCheckConstraintError(err error, constraintName string) bool {
-	e, ok := err.(*pq.Error)
-	if !ok {
-		return false
-	}
+	e := Classify(err)
 
-	return e.Code == "23514" && e.Constraint == constraintName
+	return e != nil && e.Kind == ErrorKindCheckViolation && e.Constraint == constraintName
 }
 
-// IsForeignKeyConstraintError is a helper checking the current database error and returning true if it's a PG foreign key constraint error
+// IsForeignKeyConstraintError is a helper checking the current database error and returning true if it's a foreign key constraint error
 func IsForeignKeyConstraintError(err error, constraintName string) bool {
-	e, ok := err.(*pq.Error)
-	if !ok {
-		return false
-	}
+	e := Classify(err)
 
-	return e.Code == "23503" && e.Constraint == constraintName
+	return e != nil && e.Kind == ErrorKindForeignKeyViolation && e.Constraint == constraintName
 }
 
 // IsEnumInvalidValueError is a helper checking a database error and returns true if it's a invalid input value for a given enum type
 func IsEnumInvalidValueError(err error, enumName string) bool {
-	e, ok := err.(*pq.Error)
-	if !ok {
-		return false
-	}
-	return e.Code == "22P02" && strings.Contains(e.Message, fmt.Sprintf("invalid input value for enum %s", enumName))
+	e := Classify(err)
+
+	return e != nil && e.Kind == ErrorKindInvalidValue && strings.Contains(e.Message, fmt.Sprintf("invalid input value for enum %s", enumName))
 }
 
 // GetCurrentTimestamp is a helper function that generates a new UTC timestamp truncated at the millisecond
@@ -224,7 +308,7 @@ func (db *prodDB) Begin() (Tx, error) {
 		return nil, err
 	}
 
-	return &prodTx{tx: tx}, nil
+	return &prodTx{tx: tx, dialect: db.dialect, timeouts: db.timeouts, settings: make(SessionSettings)}, nil
 }
 
 // Close closes the connection to the database
@@ -237,7 +321,9 @@ func (db *prodDB) SelectContext(ctx context.Context, dest interface{}, statement
 	var err error
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
-		err = db.db.SelectContext(ctx, dest, statement, args...)
+		err = db.withSession(ctx, func(ext sqlx.ExtContext) error {
+			return sqlx.SelectContext(ctx, ext, dest, statement, args...)
+		})
 	})
 
 	metrics.RecordError(ctx, metricQueryErrorTotal, err)
@@ -258,8 +344,9 @@ func (db *prodDB) SelectMultipleContext(ctx context.Context, dest interface{}, s
 			return
 		}
 
-		query = db.db.Rebind(query)
-		err = db.db.SelectContext(ctx, dest, query, queryArguments...)
+		err = db.withSession(ctx, func(ext sqlx.ExtContext) error {
+			return sqlx.SelectContext(ctx, ext, dest, ext.Rebind(query), queryArguments...)
+		})
 	})
 
 	metrics.RecordError(ctx, metricQueryErrorTotal, err)
@@ -272,7 +359,9 @@ func (db *prodDB) GetContext(ctx context.Context, dest interface{}, statement st
 	var err error
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
-		err = db.db.GetContext(ctx, dest, statement, args...)
+		err = db.withSession(ctx, func(ext sqlx.ExtContext) error {
+			return sqlx.GetContext(ctx, ext, dest, statement, args...)
+		})
 	})
 
 	metrics.RecordError(ctx, metricQueryErrorTotal, err)
@@ -288,7 +377,11 @@ func (db *prodDB) ExecContext(ctx context.Context, statement string, arg ...inte
 	)
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
-		response, err = db.db.ExecContext(ctx, statement, arg...)
+		err = db.withSession(ctx, func(ext sqlx.ExtContext) error {
+			var execErr error
+			response, execErr = ext.ExecContext(ctx, statement, arg...)
+			return execErr
+		})
 	})
 
 	metrics.RecordError(ctx, metricQueryErrorTotal, err)
@@ -304,7 +397,11 @@ func (db *prodDB) NamedExecContext(ctx context.Context, statement string, arg in
 	)
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
-		response, err = db.db.NamedExecContext(ctx, statement, arg)
+		err = db.withSession(ctx, func(ext sqlx.ExtContext) error {
+			var execErr error
+			response, execErr = sqlx.NamedExecContext(ctx, ext, statement, arg)
+			return execErr
+		})
 	})
 
 	metrics.RecordError(ctx, metricQueryErrorTotal, err)
@@ -325,6 +422,77 @@ func (db *prodDB) PingContext(ctx context.Context) error {
 	return err
 }
 
+// withSession runs the query on the pool or, when the context holds session settings or a deadline shorter than the
+// statement timeout, in a transaction they are applied to
+func (db *prodDB) withSession(ctx context.Context, query func(sqlx.ExtContext) error) error {
+	settings, _, err := withStatementTimeout(ctx, db.dialect, db.timeouts)
+	if err != nil {
+		return err
+	}
+
+	if len(settings) == 0 {
+		return query(db.db)
+	}
+
+	tx, err := db.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := applySessionSettings(ctx, tx, db.dialect, settings); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := query(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// applySessionSettings applies the session settings of the context which are not already applied to the transaction.
+// The statement timeout is applied by the first statement run with a deadline, the following ones only apply it again
+// when their deadline is earlier so that the statements sharing a context don't send it each time.
+func (tx *prodTx) applySessionSettings(ctx context.Context) error {
+	settings, timeout, err := withStatementTimeout(ctx, tx.dialect, tx.timeouts)
+	if err != nil {
+		return err
+	}
+
+	pending := make(SessionSettings)
+	for name, value := range settings {
+		if applied, ok := tx.settings[name]; !ok || applied != value {
+			pending[name] = value
+		}
+	}
+
+	deadline, _ := ctx.Deadline()
+	if timeout > 0 && !tx.statementDeadline.IsZero() && !deadline.Before(tx.statementDeadline) {
+		delete(pending, statementTimeoutSetting)
+	}
+
+	if err := applySessionSettings(ctx, tx.tx, tx.dialect, pending); err != nil {
+		return err
+	}
+
+	for name, value := range pending {
+		tx.settings[name] = value
+	}
+
+	if _, ok := pending[statementTimeoutSetting]; ok {
+		tx.statementDeadline = deadline
+	}
+
+	return nil
+}
+
+// Dialect returns the dialect of the SQL engine the transaction runs on
+func (tx *prodTx) Dialect() Dialect {
+	return tx.dialect
+}
+
 // Commit persists the transaction
 func (tx *prodTx) Commit() error {
 	return tx.tx.Commit()
@@ -340,6 +508,10 @@ func (tx *prodTx) GetContext(ctx context.Context, dest interface{}, statement st
 	var err error
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
+		if err = tx.applySessionSettings(ctx); err != nil {
+			return
+		}
+
 		err = tx.tx.GetContext(ctx, dest, statement, args...)
 	})
 
@@ -356,6 +528,10 @@ func (tx *prodTx) NamedExecContext(ctx context.Context, statement string, arg in
 	)
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
+		if err = tx.applySessionSettings(ctx); err != nil {
+			return
+		}
+
 		response, err = tx.tx.NamedExecContext(ctx, statement, arg)
 	})
 
@@ -369,6 +545,10 @@ func (tx *prodTx) SelectContext(ctx context.Context, dest interface{}, statement
 	var err error
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
+		if err = tx.applySessionSettings(ctx); err != nil {
+			return
+		}
+
 		err = tx.tx.SelectContext(ctx, dest, statement, args...)
 	})
 
@@ -385,6 +565,10 @@ func (tx *prodTx) ExecContext(ctx context.Context, statement string, arg ...inte
 	)
 
 	metrics.RecordElapsedTimeInMilliseconds(ctx, metricQueryLatencyMs, func() {
+		if err = tx.applySessionSettings(ctx); err != nil {
+			return
+		}
+
 		response, err = tx.tx.ExecContext(ctx, statement, arg...)
 	})
 
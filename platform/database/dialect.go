@@ -0,0 +1,231 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GuiaBolso/darwin"
+	"github.com/lib/pq"
+)
+
+// Dialect abstracts the behaviours which are specific to a SQL engine. A dialect is selected using the `driver`
+// of the database configuration. Dialects for other engines than Postgres live in their own package which registers
+// them when imported, e.g.:
+//
+//	import _ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+type Dialect interface {
+	// DriverName is the name of the database/sql driver the dialect is registered for
+	DriverName() string
+	// DataSourceName builds the string used to open a connection from the configuration
+	DataSourceName(config Config) string
+	// MigrationDialect returns the darwin dialect used to keep track of the applied migrations
+	MigrationDialect() darwin.Dialect
+	// TableExistsSQL returns a query taking a table name as its only argument and returning true if the table exists
+	TableExistsSQL() string
+	// SessionSettingSQL returns a statement taking a setting name and a value as arguments which sets the setting for
+	// the current transaction only. It returns an empty string when the engine has no such settings.
+	SessionSettingSQL() string
+	// QuoteIdentifier quotes a table or column name, each part of a schema-qualified name being quoted on its own, so
+	// that names coming from user input can't alter a statement. Quoted names are case-sensitive.
+	QuoteIdentifier(name string) string
+	// ReferencedTablesSQL returns a query taking a table name as its only argument and returning the names of the tables
+	// its foreign keys reference
+	ReferencedTablesSQL() string
+	// TranslateError converts an error returned by the driver, even wrapped, to an engine agnostic Error. It returns nil
+	// for any other error. Retryable is computed from the Kind and does not need to be set.
+	TranslateError(err error) *Error
+}
+
+var (
+	dialectsMutex sync.RWMutex
+	dialects      = map[string]Dialect{
+		PostgresDialect{}.DriverName(): PostgresDialect{},
+	}
+)
+
+// RegisterDialect makes a dialect available to the configurations using its driver name. It replaces any dialect
+// previously registered for the same driver.
+func RegisterDialect(dialect Dialect) {
+	dialectsMutex.Lock()
+	defer dialectsMutex.Unlock()
+
+	dialects[dialect.DriverName()] = dialect
+}
+
+func dialectFor(driverName string) (Dialect, error) {
+	dialectsMutex.RLock()
+	defer dialectsMutex.RUnlock()
+
+	dialect, ok := dialects[driverName]
+	if !ok {
+		var names []string
+		for name := range dialects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("no dialect registered for the driver %q (registered: %s), the package defining it might not be imported", driverName, strings.Join(names, ", "))
+	}
+
+	return dialect, nil
+}
+
+// translateError asks every registered dialect to translate the error
+func translateError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	dialectsMutex.RLock()
+	defer dialectsMutex.RUnlock()
+
+	for _, dialect := range dialects {
+		if e := dialect.TranslateError(err); e != nil {
+			e.Retryable = e.Kind.retryable()
+			return e
+		}
+	}
+
+	return nil
+}
+
+// PostgresDialect is the dialect used for the `postgres` driver
+type PostgresDialect struct{}
+
+// DriverName is the name of the lib/pq driver
+func (PostgresDialect) DriverName() string {
+	return "postgres"
+}
+
+// DataSourceName builds a connection URL from the configuration, unless an URL is already defined. The TLS settings
+// and the statement timeout of the configuration are added as parameters.
+func (PostgresDialect) DataSourceName(config Config) string {
+	parameters := postgresTLSParameters(config.TLS)
+
+	if timeout := newStatementTimeouts(config).connection(); timeout > 0 {
+		if parameters == nil {
+			parameters = make(map[string]string)
+		}
+		parameters[statementTimeoutSetting] = formatStatementTimeout(timeout)
+	}
+
+	return postgresDataSourceName(connectionURL(withTLSServerName(config)), parameters)
+}
+
+// MigrationDialect returns the darwin Postgres dialect
+func (PostgresDialect) MigrationDialect() darwin.Dialect {
+	return darwin.PostgresDialect{}
+}
+
+// TableExistsSQL checks the existence of a table in the current schema
+func (PostgresDialect) TableExistsSQL() string {
+	return `SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1)`
+}
+
+// SessionSettingSQL uses set_config which, unlike SET LOCAL, accepts the name and the value as arguments
+func (PostgresDialect) SessionSettingSQL() string {
+	return `SELECT set_config($1, $2, true)`
+}
+
+// QuoteIdentifier quotes the name with double quotes, e.g. `public.users` becomes `"public"."users"`
+func (PostgresDialect) QuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// ReferencedTablesSQL reads the foreign keys of a table in the current schema
+func (PostgresDialect) ReferencedTablesSQL() string {
+	return `
+		SELECT DISTINCT referenced.table_name
+		FROM information_schema.referential_constraints constraints
+		JOIN information_schema.table_constraints referencing
+			ON referencing.constraint_schema = constraints.constraint_schema AND referencing.constraint_name = constraints.constraint_name
+		JOIN information_schema.table_constraints referenced
+			ON referenced.constraint_schema = constraints.unique_constraint_schema AND referenced.constraint_name = constraints.unique_constraint_name
+		WHERE referencing.table_schema = current_schema() AND referencing.table_name = $1`
+}
+
+// TranslateError converts a pq.Error, even wrapped, to an Error
+func (PostgresDialect) TranslateError(err error) *Error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return nil
+	}
+
+	e := &Error{
+		Kind:       ErrorKindOther,
+		Table:      pqErr.Table,
+		Column:     pqErr.Column,
+		Constraint: pqErr.Constraint,
+		Message:    pqErr.Message,
+		Err:        err,
+	}
+
+	switch {
+	case pqErr.Code == "23505":
+		e.Kind = ErrorKindUniqueViolation
+	case pqErr.Code == "23503":
+		e.Kind = ErrorKindForeignKeyViolation
+	case pqErr.Code == "23514":
+		e.Kind = ErrorKindCheckViolation
+	case pqErr.Code == "23502":
+		e.Kind = ErrorKindNotNullViolation
+	case pqErr.Code == "42501":
+		e.Kind = ErrorKindInsufficientPrivilege
+	case pqErr.Code == "22P02":
+		e.Kind = ErrorKindInvalidValue
+	case pqErr.Code == "40001":
+		e.Kind = ErrorKindSerializationFailure
+	case pqErr.Code == "40P01":
+		e.Kind = ErrorKindDeadlock
+	case pqErr.Code == "57014", pqErr.Code == "55P03":
+		// query_canceled is raised by statement_timeout and lock_not_available by lock_timeout
+		e.Kind = ErrorKindTimeout
+	case pqErr.Code.Class() == "08", strings.HasPrefix(string(pqErr.Code), "57P"):
+		e.Kind = ErrorKindConnectionLost
+	}
+
+	return e
+}
+
+// postgresDataSourceName adds parameters to a lib/pq data source name, which is either an URL or a list of `key=value`
+// pairs
+func postgresDataSourceName(dataSourceName string, parameters map[string]string) string {
+	if len(parameters) == 0 {
+		return dataSourceName
+	}
+
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if strings.HasPrefix(dataSourceName, "postgres://") || strings.HasPrefix(dataSourceName, "postgresql://") {
+		parsed, err := url.Parse(dataSourceName)
+		if err == nil {
+			query := parsed.Query()
+			for _, name := range names {
+				query.Set(name, parameters[name])
+			}
+			parsed.RawQuery = query.Encode()
+
+			return parsed.String()
+		}
+	}
+
+	pairs := []string{dataSourceName}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s='%s'", name, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(parameters[name])))
+	}
+
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+var (
+	// ConflictMessage is the error message returned when a write conflicts with an existing resource
+	ConflictMessage = web.NewErrorMessage("409000", "the resource conflicts with an existing one")
+	// StaleVersionMessage is the error message returned when a resource is updated from an outdated version
+	StaleVersionMessage = web.NewErrorMessage("409001", "the resource has been modified since it was read")
+	// InvalidReferenceMessage is the error message returned when a write references a resource which does not exist
+	InvalidReferenceMessage = web.NewErrorMessage("422000", "the request references a resource which does not exist")
+	// ConstraintViolationMessage is the error message returned when a write violates a data constraint
+	ConstraintViolationMessage = web.NewErrorMessage("422001", "the request violates a data constraint")
+	// DatabaseUnavailableMessage is the error message returned when the database is temporarily unable to process the request
+	DatabaseUnavailableMessage = web.NewErrorMessage("503000", "the service is temporarily unavailable")
+)
+
+// ErrorMapping describes the web.Error returned for a classified database error. An empty Constraint matches any
+// constraint of the given Kind.
+type ErrorMapping struct {
+	Kind       ErrorKind
+	Constraint string
+	HTTPCode   int
+	Message    web.ErrorMessage
+	Details    web.ErrorDetails
+}
+
+// DefaultErrorMappings are the mappings used for the errors which are not handled by a more specific mapping
+var DefaultErrorMappings = []ErrorMapping{
+	{Kind: ErrorKindUniqueViolation, HTTPCode: http.StatusConflict, Message: ConflictMessage},
+	{Kind: ErrorKindStaleVersion, HTTPCode: http.StatusConflict, Message: StaleVersionMessage},
+	{Kind: ErrorKindForeignKeyViolation, HTTPCode: http.StatusUnprocessableEntity, Message: InvalidReferenceMessage},
+	{Kind: ErrorKindCheckViolation, HTTPCode: http.StatusUnprocessableEntity, Message: ConstraintViolationMessage},
+	{Kind: ErrorKindNotNullViolation, HTTPCode: http.StatusUnprocessableEntity, Message: ConstraintViolationMessage},
+	{Kind: ErrorKindTimeout, HTTPCode: http.StatusServiceUnavailable, Message: DatabaseUnavailableMessage},
+	{Kind: ErrorKindConnectionLost, HTTPCode: http.StatusServiceUnavailable, Message: DatabaseUnavailableMessage},
+	{Kind: ErrorKindSerializationFailure, HTTPCode: http.StatusServiceUnavailable, Message: DatabaseUnavailableMessage},
+	{Kind: ErrorKindDeadlock, HTTPCode: http.StatusServiceUnavailable, Message: DatabaseUnavailableMessage},
+}
+
+// ErrorMapper turns classified database errors into web errors so that handlers do not need to translate them by hand.
+// It can be used as a middleware placed after web.ErrorsMiddleware, or registered for web.RespondError with:
+//
+//	web.RegisterErrorTranslator(mapper.WebError)
+//
+// Errors which are not mapped are left untouched and still produce an unmanaged error.
+type ErrorMapper struct {
+	mappings []ErrorMapping
+}
+
+// NewErrorMapper creates an ErrorMapper trying the given mappings in order, then the DefaultErrorMappings
+func NewErrorMapper(mappings ...ErrorMapping) *ErrorMapper {
+	mapper := &ErrorMapper{}
+	mapper.mappings = append(mapper.mappings, mappings...)
+	mapper.mappings = append(mapper.mappings, DefaultErrorMappings...)
+
+	return mapper
+}
+
+// WebError returns the web.Error mapped to a database error, or nil if the error is not mapped
+func (mapper *ErrorMapper) WebError(err error) *web.Error {
+	e := Classify(err)
+	if e == nil {
+		return nil
+	}
+
+	for _, mapping := range mapper.mappings {
+		if mapping.Kind != e.Kind || (mapping.Constraint != "" && mapping.Constraint != e.Constraint) {
+			continue
+		}
+
+		return &web.Error{
+			ErrorMessage: mapping.Message,
+			HTTPCode:     mapping.HTTPCode,
+			Details:      mapping.Details,
+		}
+	}
+
+	return nil
+}
+
+// Translate wraps the web.Error mapped to a database error, as expected by web.RespondError. It returns the error
+// untouched when it already wraps a web.Error or when it is not mapped.
+func (mapper *ErrorMapper) Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var webErr *web.Error
+	if errors.As(err, &webErr) {
+		return err
+	}
+
+	webErr = mapper.WebError(err)
+	if webErr == nil {
+		return err
+	}
+
+	return fmt.Errorf("%v: %w", err, webErr)
+}
+
+// Middleware translates the database errors returned by the handlers. It must be defined after web.ErrorsMiddleware.
+func (mapper *ErrorMapper) Middleware() web.Middleware {
+	return func(before web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			return mapper.Translate(before(ctx, w, r, params))
+		}
+
+		return h
+	}
+}
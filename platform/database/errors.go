@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+)
+
+// ErrorKind is an engine agnostic category of database errors
+type ErrorKind string
+
+const (
+	// ErrorKindUniqueViolation is returned when a unique index or primary key is violated
+	ErrorKindUniqueViolation ErrorKind = "unique_violation"
+	// ErrorKindForeignKeyViolation is returned when a foreign key constraint is violated
+	ErrorKindForeignKeyViolation ErrorKind = "foreign_key_violation"
+	// ErrorKindCheckViolation is returned when a check constraint is violated
+	ErrorKindCheckViolation ErrorKind = "check_violation"
+	// ErrorKindNotNullViolation is returned when a NULL value is written to a NOT NULL column
+	ErrorKindNotNullViolation ErrorKind = "not_null_violation"
+	// ErrorKindInsufficientPrivilege is returned when the database user is not allowed to perform the operation
+	ErrorKindInsufficientPrivilege ErrorKind = "insufficient_privilege"
+	// ErrorKindInvalidValue is returned when a value can't be converted to the column type, e.g. an unknown enum value
+	ErrorKindInvalidValue ErrorKind = "invalid_value"
+	// ErrorKindSerializationFailure is returned when a transaction can't be serialized with concurrent transactions
+	ErrorKindSerializationFailure ErrorKind = "serialization_failure"
+	// ErrorKindDeadlock is returned when the transaction has been aborted to resolve a deadlock
+	ErrorKindDeadlock ErrorKind = "deadlock"
+	// ErrorKindTimeout is returned when a statement or a lock acquisition took too long, or when the context deadline is exceeded
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindConnectionLost is returned when the connection to the server is broken
+	ErrorKindConnectionLost ErrorKind = "connection_lost"
+	// ErrorKindStaleVersion is returned when a versioned update is made from an outdated version of the row
+	ErrorKindStaleVersion ErrorKind = "stale_version"
+	// ErrorKindOther is returned for any other error reported by the database engine
+	ErrorKindOther ErrorKind = "other"
+)
+
+// retryable reports whether the whole transaction can safely be run again. Timeouts and lost connections are not
+// retryable since the server might have applied the statement before the client gave up on it.
+func (kind ErrorKind) retryable() bool {
+	return kind == ErrorKindSerializationFailure || kind == ErrorKindDeadlock
+}
+
+// Error is an engine agnostic description of an error returned by a database driver. The Table, Column and Constraint
+// are only set when the engine reports them.
+type Error struct {
+	Kind       ErrorKind
+	Table      string
+	Column     string
+	Constraint string
+	Message    string
+	Retryable  bool
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the original error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify describes an error returned by any operation on a database, even wrapped with `%w`. It returns nil when the
+// error is not a database error, e.g. sql.ErrNoRows or a canceled context.
+func Classify(err error) *Error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	if e := translateError(err); e != nil {
+		return e
+	}
+
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, ErrStaleVersion):
+		return &Error{Kind: ErrorKindStaleVersion, Message: err.Error(), Err: err}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: ErrorKindTimeout, Message: err.Error(), Err: err}
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &netErr):
+		return &Error{Kind: ErrorKindConnectionLost, Message: err.Error(), Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package database
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+// InvalidFilterMessage is the error message returned when the filter or sort parameters of a request are invalid
+var InvalidFilterMessage = web.NewErrorMessage("400005", "the filter parameters are invalid")
+
+// FilterOperator is the comparison applied by a filter
+type FilterOperator string
+
+const (
+	// FilterOperatorEqual matches the rows whose column is equal to the value
+	FilterOperatorEqual FilterOperator = "="
+	// FilterOperatorNotEqual matches the rows whose column is different from the value
+	FilterOperatorNotEqual FilterOperator = "<>"
+	// FilterOperatorLessThan matches the rows whose column is lower than the value
+	FilterOperatorLessThan FilterOperator = "<"
+	// FilterOperatorLessThanOrEqual matches the rows whose column is lower than or equal to the value
+	FilterOperatorLessThanOrEqual FilterOperator = "<="
+	// FilterOperatorGreaterThan matches the rows whose column is greater than the value
+	FilterOperatorGreaterThan FilterOperator = ">"
+	// FilterOperatorGreaterThanOrEqual matches the rows whose column is greater than or equal to the value
+	FilterOperatorGreaterThanOrEqual FilterOperator = ">="
+	// FilterOperatorIn matches the rows whose column is one of the comma separated values
+	FilterOperatorIn FilterOperator = "IN"
+)
+
+// FilterType is the type a filter value is converted to before being sent to the database
+type FilterType string
+
+const (
+	// FilterTypeString keeps the value as is
+	FilterTypeString FilterType = "string"
+	// FilterTypeInteger converts the value to an int64
+	FilterTypeInteger FilterType = "integer"
+	// FilterTypeNumber converts the value to a float64
+	FilterTypeNumber FilterType = "number"
+	// FilterTypeBoolean converts the value to a bool
+	FilterTypeBoolean FilterType = "boolean"
+	// FilterTypeTime converts a RFC3339 timestamp or a YYYY-MM-DD date to a time.Time
+	FilterTypeTime FilterType = "time"
+	// FilterTypeUUID checks the value is a UUID
+	FilterTypeUUID FilterType = "uuid"
+)
+
+// Filter describes a request parameter which can be used to filter the rows, e.g.:
+//
+//	Filter{Param: "created_after", Column: "created_at", Operator: FilterOperatorGreaterThan, Type: FilterTypeTime}
+//
+// AllowedValues optionally restricts the accepted values, e.g. for an enum column.
+type Filter struct {
+	Param         string
+	Column        string
+	Operator      FilterOperator
+	Type          FilterType
+	AllowedValues []string
+}
+
+// FilterSpec declares the filters and sort fields accepted by a listing endpoint. Sorts maps the names accepted by
+// the `sort` parameter to columns. The `sort` parameter is a comma separated list of names, prefixed by `-` for a
+// descending order, e.g. `?sort=-created_at,id`. DefaultSort is used when the parameter is missing.
+// Parameters which are not declared are ignored so that the same parameters can carry pagination or path values.
+type FilterSpec struct {
+	Filters     []Filter
+	Sorts       map[string]string
+	DefaultSort string
+}
+
+// FilterCondition is a validated filter of a request
+type FilterCondition struct {
+	Column   string
+	Operator FilterOperator
+	Values   []interface{}
+}
+
+// FilterExpression is the validated result of the parsing of request parameters by a FilterSpec
+type FilterExpression struct {
+	Conditions []FilterCondition
+	SortKeys   []SortKey
+}
+
+// Parse validates the parameters of a handler. Invalid parameters are reported as a wrapped web.Error whose details
+// name every offending parameter.
+func (spec FilterSpec) Parse(params map[string]string) (FilterExpression, error) {
+	var expression FilterExpression
+	details := make(web.ErrorDetails)
+
+	for _, filter := range spec.Filters {
+		raw, ok := params[filter.Param]
+		if !ok {
+			continue
+		}
+
+		rawValues := []string{raw}
+		if filter.Operator == FilterOperatorIn {
+			rawValues = strings.Split(raw, ",")
+		}
+
+		condition := FilterCondition{Column: filter.Column, Operator: filter.Operator}
+
+		for _, rawValue := range rawValues {
+			value, err := filter.convert(strings.TrimSpace(rawValue))
+			if err != nil {
+				details[filter.Param] = err.Error()
+				break
+			}
+
+			condition.Values = append(condition.Values, value)
+		}
+
+		expression.Conditions = append(expression.Conditions, condition)
+	}
+
+	rawSort, ok := params["sort"]
+	if !ok {
+		rawSort = spec.DefaultSort
+	}
+
+	if rawSort != "" {
+		for _, name := range strings.Split(rawSort, ",") {
+			name = strings.TrimSpace(name)
+			descending := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+
+			column, ok := spec.Sorts[name]
+			if !ok {
+				details["sort"] = fmt.Sprintf("can't sort by %q, expected one of %s", name, strings.Join(spec.sortNames(), ", "))
+				break
+			}
+
+			expression.SortKeys = append(expression.SortKeys, SortKey{Column: column, Descending: descending})
+		}
+	}
+
+	if len(details) > 0 {
+		return FilterExpression{}, fmt.Errorf("%w", &web.Error{
+			HTTPCode:     http.StatusBadRequest,
+			ErrorMessage: InvalidFilterMessage,
+			Details:      details,
+		})
+	}
+
+	return expression, nil
+}
+
+func (spec FilterSpec) sortNames() []string {
+	var names []string
+	for name := range spec.Sorts {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func (filter Filter) convert(raw string) (interface{}, error) {
+	if len(filter.AllowedValues) > 0 {
+		allowed := false
+		for _, value := range filter.AllowedValues {
+			allowed = allowed || value == raw
+		}
+
+		if !allowed {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(filter.AllowedValues, ", "))
+		}
+	}
+
+	switch filter.Type {
+	case FilterTypeInteger:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return value, nil
+
+	case FilterTypeNumber:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return value, nil
+
+	case FilterTypeBoolean:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean")
+		}
+		return value, nil
+
+	case FilterTypeTime:
+		if value, err := time.Parse(time.RFC3339, raw); err == nil {
+			return value, nil
+		}
+
+		value, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a RFC3339 timestamp or a YYYY-MM-DD date")
+		}
+		return value, nil
+
+	case FilterTypeUUID:
+		if _, err := uuid.Parse(raw); err != nil {
+			return nil, fmt.Errorf("must be a UUID")
+		}
+		return raw, nil
+	}
+
+	return raw, nil
+}
+
+// Where renders the conditions joined by AND with question mark placeholders, which can be rebound with sqlx.Rebind.
+// It returns an empty string when there is no condition.
+func (expression FilterExpression) Where() (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	for _, condition := range expression.Conditions {
+		if condition.Operator == FilterOperatorIn {
+			placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(condition.Values)), ", ")
+			conditions = append(conditions, fmt.Sprintf("%s IN (%s)", condition.Column, placeholders))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("%s %s ?", condition.Column, condition.Operator))
+		}
+
+		args = append(args, condition.Values...)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// OrderBy renders the sort keys, e.g. `created_at DESC, id ASC`. It returns an empty string when there is no sort key.
+func (expression FilterExpression) OrderBy() string {
+	orders := make([]string, len(expression.SortKeys))
+	for i, key := range expression.SortKeys {
+		direction := "ASC"
+		if key.Descending {
+			direction = "DESC"
+		}
+
+		orders[i] = fmt.Sprintf("%s %s", key.Column, direction)
+	}
+
+	return strings.Join(orders, ", ")
+}
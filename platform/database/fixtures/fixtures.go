@@ -0,0 +1,410 @@
+// Package fixtures loads declarative test rows into a database. Fixture files are YAML or JSON documents mapping
+// table names to named rows:
+//
+//	users:
+//	  alice:
+//	    id: uuid()
+//	    email: alice@example.com
+//	    created_at: now(-24h)
+//	posts:
+//	  first_post:
+//	    id: uuid()
+//	    user_id: ref(alice)
+//	    author_email: ref(alice.email)
+//
+// The following functions can be used as values:
+//   - uuid() generates a random UUID
+//   - now() is the current time, now(-24h) and now(1h30m) add a duration to it
+//   - ref(name) is the id of the row with the given name and ref(name.column) any other column of it
+//
+// Row names must be unique across the loaded files. Rows are inserted after the rows they reference, either with ref()
+// or through the foreign keys of their table, the other rows keep the order of the files. The foreign keys between
+// tables referencing each other are ignored, such rows must use ref() to be ordered.
+package fixtures
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/yaml.v2"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+)
+
+// DefaultReferenceColumn is the column used by a reference which does not specify one
+const DefaultReferenceColumn = "id"
+
+var functionRegex = regexp.MustCompile(`^(uuid|now|ref)\(\s*([^)]*?)\s*\)$`)
+
+// Row is a row loaded in the database. Values only contains the columns defined in the fixture files, with the
+// functions resolved.
+type Row struct {
+	Table  string
+	Values map[string]interface{}
+}
+
+// Fixtures are the loaded rows indexed by their name
+type Fixtures map[string]Row
+
+// Get returns the value of a column of a loaded row, or nil if the row or the column is not defined
+func (fixtures Fixtures) Get(name string, column string) interface{} {
+	return fixtures[name].Values[column]
+}
+
+// String returns the value of a column of a loaded row formatted as a string
+func (fixtures Fixtures) String(name string, column string) string {
+	value := fixtures.Get(name, column)
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// fixture is a row as defined in a fixture file
+type fixture struct {
+	name    string
+	table   string
+	file    string
+	columns yaml.MapSlice
+	// references are the names of the rows this row references
+	references []string
+}
+
+// Load reads the fixture files from the file system and inserts their rows. The files are parsed as YAML, which makes
+// JSON files valid as well.
+func Load(ctx context.Context, db database.WriteDB, fsys fs.FS, files ...string) (Fixtures, error) {
+	var fixtures []*fixture
+
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("can't read fixture file %s: %v", file, err)
+		}
+
+		parsed, err := parse(file, content)
+		if err != nil {
+			return nil, err
+		}
+
+		fixtures = append(fixtures, parsed...)
+	}
+
+	referencedTables, err := readReferencedTables(ctx, db, fixtures)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered, err := sortByReferences(fixtures, referencedTables)
+	if err != nil {
+		return nil, err
+	}
+
+	return insert(ctx, db, ordered)
+}
+
+func parse(file string, content []byte) ([]*fixture, error) {
+	var tables yaml.MapSlice
+	if err := yaml.Unmarshal(content, &tables); err != nil {
+		return nil, fmt.Errorf("can't parse fixture file %s: %v", file, err)
+	}
+
+	var fixtures []*fixture
+
+	for _, table := range tables {
+		rows, ok := table.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, fmt.Errorf("invalid fixture file %s: table %v must map row names to rows", file, table.Key)
+		}
+
+		for _, row := range rows {
+			columns, ok := row.Value.(yaml.MapSlice)
+			if !ok {
+				return nil, fmt.Errorf("invalid fixture file %s: row %v of table %v must map columns to values", file, row.Key, table.Key)
+			}
+
+			f := &fixture{
+				name:    fmt.Sprintf("%v", row.Key),
+				table:   fmt.Sprintf("%v", table.Key),
+				file:    file,
+				columns: columns,
+			}
+
+			for _, column := range columns {
+				if name, _, ok := parseReference(column.Value); ok {
+					f.references = append(f.references, name)
+				}
+			}
+
+			fixtures = append(fixtures, f)
+		}
+	}
+
+	return fixtures, nil
+}
+
+// readReferencedTables reads the tables referenced by the foreign keys of the tables of the fixtures
+func readReferencedTables(ctx context.Context, db database.WriteDB, fixtures []*fixture) (map[string][]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("can't begin the transaction reading the foreign keys: %v", err)
+	}
+	defer tx.Rollback()
+
+	statement := tx.Dialect().ReferencedTablesSQL()
+	referencedTables := make(map[string][]string)
+
+	for _, f := range fixtures {
+		if _, ok := referencedTables[f.table]; ok {
+			continue
+		}
+
+		var tables []string
+		if err := tx.SelectContext(ctx, &tables, statement, f.table); err != nil {
+			return nil, fmt.Errorf("can't read the foreign keys of table %s: %v", f.table, err)
+		}
+
+		referencedTables[f.table] = tables
+	}
+
+	return referencedTables, nil
+}
+
+// sortByReferences orders the rows so that every row comes after the rows it references and after the rows of the
+// tables its table references. When only the foreign keys prevent any row from being inserted, the tables reference
+// each other and the first row whose references are inserted is inserted anyway.
+func sortByReferences(fixtures []*fixture, referencedTables map[string][]string) ([]*fixture, error) {
+	byName := make(map[string]*fixture, len(fixtures))
+	for _, f := range fixtures {
+		if existing, ok := byName[f.name]; ok {
+			return nil, fmt.Errorf("duplicate fixture name %s in %s and %s", f.name, existing.file, f.file)
+		}
+
+		byName[f.name] = f
+	}
+
+	for _, f := range fixtures {
+		for _, reference := range f.references {
+			if _, ok := byName[reference]; !ok {
+				return nil, fmt.Errorf("fixture %s of %s references the unknown fixture %s", f.name, f.file, reference)
+			}
+		}
+	}
+
+	ordered := make([]*fixture, 0, len(fixtures))
+	inserted := make(map[string]bool, len(fixtures))
+	pending := make(map[string]int)
+	for _, f := range fixtures {
+		pending[f.table]++
+	}
+
+	add := func(f *fixture) {
+		ordered = append(ordered, f)
+		inserted[f.name] = true
+		pending[f.table]--
+	}
+
+	for len(ordered) < len(fixtures) {
+		progress := false
+
+		for _, f := range fixtures {
+			if inserted[f.name] || !referencesInserted(f, inserted) || !referencedTablesInserted(f, referencedTables, pending) {
+				continue
+			}
+
+			add(f)
+			progress = true
+		}
+
+		if progress {
+			continue
+		}
+
+		for _, f := range fixtures {
+			if !inserted[f.name] && referencesInserted(f, inserted) {
+				add(f)
+				progress = true
+
+				break
+			}
+		}
+
+		if !progress {
+			var cycle []string
+			for _, f := range fixtures {
+				if !inserted[f.name] {
+					cycle = append(cycle, f.name)
+				}
+			}
+			sort.Strings(cycle)
+
+			return nil, fmt.Errorf("circular references between the fixtures %s", strings.Join(cycle, ", "))
+		}
+	}
+
+	return ordered, nil
+}
+
+func referencesInserted(f *fixture, inserted map[string]bool) bool {
+	for _, reference := range f.references {
+		if !inserted[reference] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// referencedTablesInserted tells whether all the rows of the tables referenced by the table of the fixture are
+// inserted, a table referencing itself being ordered by ref() only
+func referencedTablesInserted(f *fixture, referencedTables map[string][]string, pending map[string]int) bool {
+	for _, table := range referencedTables[f.table] {
+		if table != f.table && pending[table] > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func insert(ctx context.Context, db database.WriteDB, ordered []*fixture) (Fixtures, error) {
+	fixtures := make(Fixtures, len(ordered))
+	dialect := db.Dialect()
+	bindType := sqlx.BindType(dialect.DriverName())
+
+	for _, f := range ordered {
+		row := Row{Table: f.table, Values: make(map[string]interface{}, len(f.columns))}
+
+		columns := make([]string, 0, len(f.columns))
+		placeholders := make([]string, 0, len(f.columns))
+		args := make([]interface{}, 0, len(f.columns))
+
+		for _, column := range f.columns {
+			name := fmt.Sprintf("%v", column.Key)
+
+			value, err := resolve(fixtures, column.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s.%s in fixture %s of %s: %v", f.table, name, f.name, f.file, err)
+			}
+
+			row.Values[name] = value
+			columns = append(columns, dialect.QuoteIdentifier(name))
+			placeholders = append(placeholders, "?")
+			args = append(args, value)
+		}
+
+		statement := sqlx.Rebind(bindType, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", dialect.QuoteIdentifier(f.table), strings.Join(columns, ", "), strings.Join(placeholders, ", ")))
+		if _, err := db.ExecContext(ctx, statement, args...); err != nil {
+			return nil, fmt.Errorf("can't insert fixture %s of %s: %v", f.name, f.file, err)
+		}
+
+		fixtures[f.name] = row
+	}
+
+	return fixtures, nil
+}
+
+// resolve computes the value inserted for a column value of a fixture file
+func resolve(fixtures Fixtures, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case yaml.MapSlice, []interface{}:
+		// nested documents are stored as JSON, e.g. in JSONB columns
+		encoded, err := json.Marshal(toJSONValue(v))
+		if err != nil {
+			return nil, err
+		}
+
+		return string(encoded), nil
+
+	case string:
+		matches := functionRegex.FindStringSubmatch(v)
+		if matches == nil {
+			return v, nil
+		}
+
+		switch matches[1] {
+		case "uuid":
+			return uuid.New().String(), nil
+
+		case "now":
+			now := database.GetCurrentTimestamp()
+			if matches[2] == "" {
+				return now, nil
+			}
+
+			offset, err := time.ParseDuration(matches[2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid duration in %s: %v", v, err)
+			}
+
+			return now.Add(offset), nil
+
+		case "ref":
+			name, column, _ := parseReference(v)
+
+			row, ok := fixtures[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fixture %s", name)
+			}
+
+			referenced, ok := row.Values[column]
+			if !ok {
+				return nil, fmt.Errorf("fixture %s does not define the column %s", name, column)
+			}
+
+			return referenced, nil
+		}
+	}
+
+	return value, nil
+}
+
+// parseReference returns the row name and column of a `ref(name)` or `ref(name.column)` value
+func parseReference(value interface{}) (string, string, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return "", "", false
+	}
+
+	matches := functionRegex.FindStringSubmatch(s)
+	if matches == nil || matches[1] != "ref" {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(matches[2], ".", 2)
+	if len(parts) == 1 {
+		return parts[0], DefaultReferenceColumn, true
+	}
+
+	return parts[0], parts[1], true
+}
+
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		object := make(map[string]interface{}, len(v))
+		for _, item := range v {
+			object[fmt.Sprintf("%v", item.Key)] = toJSONValue(item.Value)
+		}
+
+		return object
+
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, item := range v {
+			array[i] = toJSONValue(item)
+		}
+
+		return array
+	}
+
+	return value
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/fewlinesco/go-pkg/platform/database/fixtures"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+)
+
+func connect(t *testing.T) database.DB {
+	db, err := database.Connect(database.Config{
+		Driver:   "sqlite3",
+		Database: filepath.Join(t.TempDir(), "fixtures.db"),
+		Options:  map[string]string{"_foreign_keys": "1"},
+	})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+
+	err = database.MigrateWithOptions(db, []database.Migration{
+		{
+			Version:     1,
+			Description: "Create the tables",
+			Script: `
+				CREATE TABLE users (id TEXT PRIMARY KEY, email TEXT NOT NULL, created_at TIMESTAMP NOT NULL, settings TEXT);
+				CREATE TABLE posts (id TEXT PRIMARY KEY, user_id TEXT NOT NULL REFERENCES users (id), author_email TEXT NOT NULL);
+				CREATE TABLE comments (id TEXT PRIMARY KEY, post_id TEXT NOT NULL REFERENCES posts (id), parent_id TEXT REFERENCES comments (id));
+				CREATE TABLE tags (id TEXT PRIMARY KEY, post_id TEXT NOT NULL REFERENCES posts (id), "order" INTEGER NOT NULL);`,
+		},
+	}, database.MigrationOptions{})
+	if err != nil {
+		t.Fatalf("could not migrate the database: %v", err)
+	}
+
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"comments.yml": {Data: []byte(`
+comments:
+  answer:
+    id: uuid()
+    post_id: ref(first_post)
+    parent_id: ref(question)
+  question:
+    id: uuid()
+    post_id: ref(first_post)
+`)},
+		"posts.json": {Data: []byte(`{"posts": {"first_post": {"id": "uuid()", "user_id": "ref(alice)", "author_email": "ref(alice.email)"}}}`)},
+		"users.yml": {Data: []byte(`
+users:
+  alice:
+    id: uuid()
+    email: alice@example.com
+    created_at: now(-24h)
+    settings:
+      theme: dark
+`)},
+		"tags.yml":     {Data: []byte("tags:\n  pinned:\n    id: pinned\n    post_id: literal_post\n    order: 1\n")},
+		"literal.yml":  {Data: []byte("posts:\n  literal_post:\n    id: literal_post\n    user_id: literal_user\n    author_email: bob@example.com\nusers:\n  literal_user:\n    id: literal_user\n    email: bob@example.com\n    created_at: now()\n")},
+		"unknown.yml":  {Data: []byte("posts:\n  orphan:\n    id: uuid()\n    user_id: ref(bob)\n")},
+		"circular.yml": {Data: []byte("comments:\n  first:\n    id: ref(second)\n  second:\n    id: ref(first)\n")},
+	}
+
+	t.Run("it loads the rows in reference order", func(t *testing.T) {
+		db := connect(t)
+		defer db.Close()
+
+		loaded, err := fixtures.Load(context.Background(), db, fsys, "comments.yml", "posts.json", "users.yml")
+		if err != nil {
+			t.Fatalf("could not load the fixtures: %v", err)
+		}
+
+		if loaded.String("first_post", "user_id") != loaded.String("alice", "id") {
+			t.Fatalf("expected the post to reference alice but got %v", loaded.Get("first_post", "user_id"))
+		}
+
+		if loaded.String("first_post", "author_email") != "alice@example.com" {
+			t.Fatalf("expected the reference to a column to be resolved but got %v", loaded.Get("first_post", "author_email"))
+		}
+
+		if loaded.String("answer", "parent_id") != loaded.String("question", "id") {
+			t.Fatalf("expected the answer to reference the question")
+		}
+
+		createdAt, ok := loaded.Get("alice", "created_at").(time.Time)
+		if !ok || time.Since(createdAt) < 23*time.Hour || time.Since(createdAt) > 25*time.Hour {
+			t.Fatalf("expected created_at to be a day ago but got %v", loaded.Get("alice", "created_at"))
+		}
+
+		if loaded.String("alice", "settings") != `{"theme":"dark"}` {
+			t.Fatalf("expected the nested document to be stored as JSON but got %v", loaded.Get("alice", "settings"))
+		}
+
+		var email string
+		if err := db.GetContext(context.Background(), &email, `SELECT email FROM users WHERE id = ?`, loaded.Get("alice", "id")); err != nil {
+			t.Fatalf("could not read the loaded user: %v", err)
+		}
+
+		if email != "alice@example.com" {
+			t.Fatalf("unexpected email %s", email)
+		}
+	})
+
+	t.Run("it loads the rows in foreign key order and quotes the column names", func(t *testing.T) {
+		db := connect(t)
+		defer db.Close()
+
+		if _, err := fixtures.Load(context.Background(), db, fsys, "tags.yml", "literal.yml"); err != nil {
+			t.Fatalf("could not load the fixtures: %v", err)
+		}
+
+		var order int
+		if err := db.GetContext(context.Background(), &order, `SELECT "order" FROM tags WHERE post_id = 'literal_post'`); err != nil {
+			t.Fatalf("could not read the loaded tag: %v", err)
+		}
+
+		if order != 1 {
+			t.Fatalf("unexpected order %d", order)
+		}
+	})
+
+	t.Run("it refuses invalid references", func(t *testing.T) {
+		for _, file := range []string{"unknown.yml", "circular.yml"} {
+			db := connect(t)
+
+			if _, err := fixtures.Load(context.Background(), db, fsys, file); err == nil {
+				t.Fatalf("expected %s not to be loaded", file)
+			}
+
+			db.Close()
+		}
+	})
+}
@@ -3,13 +3,15 @@ package database
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"go.opencensus.io/trace"
 
 	"github.com/fewlinesco/go-pkg/platform/web"
 )
 
-// HealthCheck is a generic health checker in charge of checking the database availability
+// HealthCheck is a generic health checker in charge of checking the database availability. With Postgres, its
+// metadata also report whether the connection is encrypted.
 func (db *prodDB) HealthCheck(dbName string) web.HealthzChecker {
 	return genericHealthCheck(dbName)(db)
 }
@@ -42,6 +44,19 @@ func genericHealthCheck(databaseName string) func(db DB) web.HealthzChecker {
 				span.AddAttributes(trace.StringAttribute("database-health-error", errorMessage))
 
 				service.State = web.HealthzStateUnhealthy
+
+				return service
+			}
+
+			if db.Dialect().DriverName() == (PostgresDialect{}).DriverName() {
+				var security connectionSecurity
+				if err := db.GetContext(ctx, &security, connectionSecurityQuery); err == nil {
+					service.Metadata = map[string]string{"encrypted": strconv.FormatBool(security.Encrypted)}
+					if security.Encrypted {
+						service.Metadata["tls_version"] = security.Version
+						service.Metadata["tls_cipher"] = security.Cipher
+					}
+				}
 			}
 
 			return service
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+// IdempotencyKeysTable is the table the IdempotencyStore keeps the idempotency keys in
+const IdempotencyKeysTable = "idempotency_keys"
+
+const (
+	// DefaultIdempotencyKeyTTL is the time an idempotency key is kept when the store does not specify one
+	DefaultIdempotencyKeyTTL = 24 * time.Hour
+	// DefaultIdempotencyKeyLease is the time a key stays in flight when the store does not specify one
+	DefaultIdempotencyKeyLease = time.Minute
+)
+
+// IdempotencyKeysMigration creates the table of the IdempotencyStore
+func IdempotencyKeysMigration(version float64) Migration {
+	return Migration{
+		Version:     version,
+		Description: "Create the idempotency keys",
+		Script: fmt.Sprintf(`
+			CREATE TABLE %[1]s (
+				idempotency_key TEXT PRIMARY KEY,
+				fingerprint TEXT NOT NULL,
+				status_code INTEGER,
+				response_headers TEXT,
+				response_body BYTEA,
+				created_at TIMESTAMPTZ NOT NULL,
+				locked_at TIMESTAMPTZ
+			);
+
+			CREATE INDEX %[1]s_created_at_idx ON %[1]s (created_at)`, IdempotencyKeysTable),
+		DownScript: fmt.Sprintf(`DROP TABLE %s`, IdempotencyKeysTable),
+	}
+}
+
+// IdempotencyStore is a web.IdempotencyStore keeping the keys in the IdempotencyKeysTable. A key and its response expire
+// after the TTL. A key without a response is locked for the lease only, after which its request is considered lost,
+// e.g. because its instance died while handling it, and the key can be reserved again. The lease must be longer than
+// the time taken by the slowest request.
+type IdempotencyStore struct {
+	db    DB
+	ttl   time.Duration
+	lease time.Duration
+}
+
+// NewIdempotencyStore returns a store keeping the keys for the TTL, DefaultIdempotencyKeyTTL when it is 0, and locking
+// the keys in flight for the lease, DefaultIdempotencyKeyLease when it is 0
+func NewIdempotencyStore(db DB, ttl time.Duration, lease time.Duration) *IdempotencyStore {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyKeyTTL
+	}
+
+	if lease <= 0 {
+		lease = DefaultIdempotencyKeyLease
+	}
+
+	return &IdempotencyStore{db: db, ttl: ttl, lease: lease}
+}
+
+type idempotencyKey struct {
+	Fingerprint string         `db:"fingerprint"`
+	StatusCode  sql.NullInt64  `db:"status_code"`
+	Headers     sql.NullString `db:"response_headers"`
+	Body        []byte         `db:"response_body"`
+}
+
+func (store *IdempotencyStore) rebind(statement string) string {
+	return sqlx.Rebind(sqlx.BindType(store.db.Dialect().DriverName()), fmt.Sprintf(statement, IdempotencyKeysTable))
+}
+
+// Reserve inserts the key unless it is already known, in which case its record is returned. An expired key, or a key
+// whose lease expired before a response was saved, is replaced.
+func (store *IdempotencyStore) Reserve(ctx context.Context, key string, fingerprint string) (*web.IdempotencyRecord, error) {
+	now := time.Now().UTC()
+
+	if _, err := store.db.ExecContext(ctx, store.rebind(`
+		DELETE FROM %s
+		WHERE idempotency_key = ? AND (created_at < ? OR (status_code IS NULL AND locked_at < ?))`),
+		key, now.Add(-store.ttl), now.Add(-store.lease)); err != nil {
+		return nil, fmt.Errorf("can't expire the idempotency key: %v", err)
+	}
+
+	result, err := store.db.ExecContext(ctx, store.rebind(`
+		INSERT INTO %s (idempotency_key, fingerprint, created_at, locked_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (idempotency_key) DO NOTHING`), key, fingerprint, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("can't insert the idempotency key: %v", err)
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("can't insert the idempotency key: %v", err)
+	}
+
+	if inserted == 1 {
+		return nil, nil
+	}
+
+	var existing idempotencyKey
+	if err := store.db.GetContext(ctx, &existing, store.rebind(`
+		SELECT fingerprint, status_code, response_headers, response_body
+		FROM %s
+		WHERE idempotency_key = ?`), key); err != nil {
+		return nil, fmt.Errorf("can't read the idempotency key: %v", err)
+	}
+
+	record := &web.IdempotencyRecord{Fingerprint: existing.Fingerprint}
+	if existing.StatusCode.Valid {
+		record.Response = &web.IdempotentResponse{
+			StatusCode: int(existing.StatusCode.Int64),
+			Body:       existing.Body,
+		}
+
+		if existing.Headers.Valid {
+			if err := json.Unmarshal([]byte(existing.Headers.String), &record.Response.Header); err != nil {
+				return nil, fmt.Errorf("can't decode the headers of the idempotency key: %v", err)
+			}
+		}
+	}
+
+	return record, nil
+}
+
+// Save records the response of the key
+func (store *IdempotencyStore) Save(ctx context.Context, key string, response web.IdempotentResponse) error {
+	headers, err := json.Marshal(response.Header)
+	if err != nil {
+		return fmt.Errorf("can't encode the headers of the idempotency key: %v", err)
+	}
+
+	if _, err := store.db.ExecContext(ctx, store.rebind(`
+		UPDATE %s SET status_code = ?, response_headers = ?, response_body = ?, locked_at = NULL
+		WHERE idempotency_key = ?`), response.StatusCode, string(headers), response.Body, key); err != nil {
+		return fmt.Errorf("can't save the response of the idempotency key: %v", err)
+	}
+
+	return nil
+}
+
+// Release deletes the key, unless a response has been saved for it
+func (store *IdempotencyStore) Release(ctx context.Context, key string) error {
+	if _, err := store.db.ExecContext(ctx, store.rebind(`DELETE FROM %s WHERE idempotency_key = ? AND status_code IS NULL`), key); err != nil {
+		return fmt.Errorf("can't release the idempotency key: %v", err)
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes the expired keys and returns how many were deleted. It is meant to be run periodically.
+func (store *IdempotencyStore) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := store.db.ExecContext(ctx, store.rebind(`DELETE FROM %s WHERE created_at < ?`), time.Now().UTC().Add(-store.ttl))
+	if err != nil {
+		return 0, fmt.Errorf("can't purge the idempotency keys: %v", err)
+	}
+
+	return result.RowsAffected()
+}
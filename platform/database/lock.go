@@ -0,0 +1,301 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+var (
+	// ErrLockNotAcquired is returned when a lock is still held by another session once the timeout is reached
+	ErrLockNotAcquired = errors.New("the lock is held by another session")
+	// ErrLockLost is reported by a Lock whose connection died: the server released the lock with the session
+	ErrLockLost = errors.New("the lock has been lost with its connection")
+	// ErrLockReleased is returned when releasing a lock twice
+	ErrLockReleased = errors.New("the lock has already been released")
+)
+
+var (
+	// LockPollInterval is the time between two attempts of TryAcquireLock
+	LockPollInterval = 100 * time.Millisecond
+	// LockCheckInterval is the time between two checks of the connection holding a session lock
+	LockCheckInterval = 5 * time.Second
+)
+
+// LockKey hashes the name of a lock to the key of the Postgres advisory lock
+func LockKey(name string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+
+	return int64(hash.Sum64())
+}
+
+// lockConnector is implemented by the databases able to give a dedicated connection to a session lock
+type lockConnector interface {
+	lockConn(ctx context.Context) (*sql.Conn, error)
+}
+
+func (db *prodDB) lockConn(ctx context.Context) (*sql.Conn, error) {
+	return db.db.Conn(ctx)
+}
+
+// lockConn uses a connection outside of the sandbox transaction as a session lock outlives the transactions
+func (db *sandboxDB) lockConn(ctx context.Context) (*sql.Conn, error) {
+	return db.db.Conn(ctx)
+}
+
+// Lock is a session-level Postgres advisory lock. It is held by a dedicated connection until it is released, or until
+// the connection dies in which case the server releases it: Lost is then closed so that the holder can stop the work
+// the lock protects.
+type Lock struct {
+	name string
+	key  int64
+	conn *sql.Conn
+
+	mutex    sync.Mutex
+	released bool
+	err      error
+	lost     chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// AcquireLock waits until the named session lock is acquired or the context is done. Advisory locks are specific to
+// Postgres.
+func AcquireLock(ctx context.Context, db DB, name string) (*Lock, error) {
+	conn, err := lockConnection(ctx, db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	key := LockKey(name)
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		// the lock may have been granted as the context was cancelled
+		discardConn(conn)
+		return nil, fmt.Errorf("can't acquire the lock %s: %w", name, err)
+	}
+
+	return newLock(name, key, conn), nil
+}
+
+// TryAcquireLock tries to acquire the named session lock until the timeout is reached. A timeout of 0 makes a single
+// attempt. When the lock is still held by another session, ErrLockNotAcquired is returned wrapped with a description
+// of the holder.
+func TryAcquireLock(ctx context.Context, db DB, name string, timeout time.Duration) (*Lock, error) {
+	conn, err := lockConnection(ctx, db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	key := LockKey(name)
+	deadline := time.Now().Add(timeout)
+
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+			discardConn(conn)
+			return nil, fmt.Errorf("can't acquire the lock %s: %w", name, err)
+		}
+
+		if acquired {
+			return newLock(name, key, conn), nil
+		}
+
+		if !time.Now().Add(LockPollInterval).Before(deadline) {
+			holder := describeLockHolder(ctx, conn, key)
+			discardConn(conn)
+
+			return nil, fmt.Errorf("%w: %s is held by %s", ErrLockNotAcquired, name, holder)
+		}
+
+		select {
+		case <-ctx.Done():
+			discardConn(conn)
+			return nil, fmt.Errorf("can't acquire the lock %s: %w", name, ctx.Err())
+		case <-time.After(LockPollInterval):
+		}
+	}
+}
+
+func lockConnection(ctx context.Context, db DB, name string) (*sql.Conn, error) {
+	if _, ok := db.Dialect().(PostgresDialect); !ok {
+		return nil, fmt.Errorf("can't acquire the lock %s: advisory locks are not supported by the %s driver", name, db.Dialect().DriverName())
+	}
+
+	connector, ok := db.(lockConnector)
+	if !ok {
+		return nil, fmt.Errorf("can't acquire the lock %s: the database can't hold session locks", name)
+	}
+
+	conn, err := connector.lockConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get a connection for the lock %s: %v", name, err)
+	}
+
+	return conn, nil
+}
+
+func newLock(name string, key int64, conn *sql.Conn) *Lock {
+	lock := &Lock{
+		name: name,
+		key:  key,
+		conn: conn,
+		lost: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	lock.wg.Add(1)
+	go lock.monitor()
+
+	return lock
+}
+
+// monitor checks the connection holding the lock until the lock is released
+func (lock *Lock) monitor() {
+	defer lock.wg.Done()
+
+	ticker := time.NewTicker(LockCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-lock.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), LockCheckInterval)
+		err := lock.conn.PingContext(ctx)
+		cancel()
+
+		if err != nil {
+			lock.mutex.Lock()
+			lock.err = fmt.Errorf("%w: %s: %v", ErrLockLost, lock.name, err)
+			lock.mutex.Unlock()
+
+			// the ping may only have timed out on a slow server, the session must not go back to the pool with the lock
+			close(lock.lost)
+			discardConn(lock.conn)
+
+			return
+		}
+	}
+}
+
+// Name returns the name of the lock
+func (lock *Lock) Name() string {
+	return lock.name
+}
+
+// Lost is closed when the connection holding the lock dies
+func (lock *Lock) Lost() <-chan struct{} {
+	return lock.lost
+}
+
+// Err returns a wrapped ErrLockLost once the lock has been lost, nil otherwise
+func (lock *Lock) Err() error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	return lock.err
+}
+
+// HealthCheck reports the lock as unhealthy once it has been lost, which is meant for the services whose work can't be
+// done without the lock, e.g. a leader holding its lock for its lifetime
+func (lock *Lock) HealthCheck() web.HealthzChecker {
+	return func(ctx context.Context) web.HealthzStatus {
+		_, span := trace.StartSpan(ctx, "database.LockHealthChecker")
+		defer span.End()
+
+		service := web.HealthzStatus{
+			Type:        "Database",
+			Description: fmt.Sprintf("Check the session still holds the lock %s", lock.name),
+			State:       web.HealthzStateHealthy,
+			Metadata:    map[string]string{"lock": lock.name},
+		}
+
+		if err := lock.Err(); err != nil {
+			service.Error = err.Error()
+			service.State = web.HealthzStateUnhealthy
+			span.AddAttributes(trace.StringAttribute("database-health-error", service.Error))
+		}
+
+		return service
+	}
+}
+
+// Release releases the lock and returns its connection to the pool. When the lock can't be released, e.g. because the
+// context is done, the connection is closed so that the server releases the lock. A lost lock is already released by
+// the server.
+func (lock *Lock) Release(ctx context.Context) error {
+	lock.mutex.Lock()
+	if lock.released {
+		lock.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrLockReleased, lock.name)
+	}
+	lock.released = true
+	lock.mutex.Unlock()
+
+	close(lock.done)
+	lock.wg.Wait()
+
+	if lock.Err() != nil {
+		return nil
+	}
+
+	if _, err := lock.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, lock.key); err != nil {
+		discardConn(lock.conn)
+		return fmt.Errorf("can't release the lock %s, its connection has been closed for the server to release it: %v", lock.name, err)
+	}
+
+	return lock.conn.Close()
+}
+
+// discardConn closes the physical connection instead of returning it to the pool, a connection whose session may
+// still hold a lock must never be reused by another query
+func discardConn(conn *sql.Conn) {
+	conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+// LockTx waits until the named transaction-level lock is acquired or the context is done. The lock is released when
+// the transaction ends. Within a sandbox, it is held until the sandbox is closed.
+func LockTx(ctx context.Context, tx Tx, name string) error {
+	if _, ok := tx.Dialect().(PostgresDialect); !ok {
+		return fmt.Errorf("can't acquire the lock %s: advisory locks are not supported by the %s driver", name, tx.Dialect().DriverName())
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, LockKey(name)); err != nil {
+		return fmt.Errorf("can't acquire the lock %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// TryLockTx tries once to acquire the named transaction-level lock and returns a wrapped ErrLockNotAcquired when it
+// is held by another session
+func TryLockTx(ctx context.Context, tx Tx, name string) error {
+	if _, ok := tx.Dialect().(PostgresDialect); !ok {
+		return fmt.Errorf("can't acquire the lock %s: advisory locks are not supported by the %s driver", name, tx.Dialect().DriverName())
+	}
+
+	var acquired bool
+	if err := tx.GetContext(ctx, &acquired, `SELECT pg_try_advisory_xact_lock($1)`, LockKey(name)); err != nil {
+		return fmt.Errorf("can't acquire the lock %s: %w", name, err)
+	}
+
+	if !acquired {
+		return fmt.Errorf("%w: %s", ErrLockNotAcquired, name)
+	}
+
+	return nil
+}
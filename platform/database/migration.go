@@ -1,20 +1,470 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/GuiaBolso/darwin"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fewlinesco/go-pkg/platform/logging"
 )
 
+// Migration represents a database migration. The DownScript is optional and is only required to roll the migration back.
+// Only the Script is used to compute the checksum so that migrations created with darwin stay valid.
+type Migration struct {
+	Version     float64
+	Description string
+	Script      string
+	DownScript  string
+}
+
+// MigrationStatus represents the state of a migration compared to the migrations applied on the database
+type MigrationStatus string
+
+const (
+	// MigrationStatusApplied the migration has been applied and its script did not change since
+	MigrationStatusApplied MigrationStatus = "applied"
+	// MigrationStatusPending the migration has not been applied yet and will be applied by the next run
+	MigrationStatusPending MigrationStatus = "pending"
+	// MigrationStatusChecksumMismatch the migration has been applied but its script changed since
+	MigrationStatusChecksumMismatch MigrationStatus = "checksum mismatch"
+	// MigrationStatusIgnored the migration has not been applied but a more recent one has so it will never be applied
+	MigrationStatusIgnored MigrationStatus = "ignored"
+	// MigrationStatusMissing the migration has been applied on the database but is not part of the migration set
+	MigrationStatusMissing MigrationStatus = "missing"
+)
+
+// MigrationInfo describes the status of one migration. AppliedAt is nil for migrations which have not been applied.
+type MigrationInfo struct {
+	Version     float64
+	Description string
+	Status      MigrationStatus
+	AppliedAt   *time.Time
+}
+
+// MigrationOptions describes a set of options altering the way migrations are run.
+// When DryRun is set, the SQL which would have been executed is written to the Output (stdout by default) instead of being executed.
+// Migrations are run while holding a Postgres advisory lock, other instances wait up to LockTimeout for it to be released
+// (DefaultMigrationLockTimeout by default) and report who holds it with the Logger (a default logger if nil).
+type MigrationOptions struct {
+	DryRun      bool
+	Output      io.Writer
+	LockTimeout time.Duration
+	Logger      *logging.Logger
+}
+
+func (options MigrationOptions) output() io.Writer {
+	if options.Output == nil {
+		return os.Stdout
+	}
+
+	return options.Output
+}
+
+// Checksum computes the checksum of the migration the same way darwin does
+func (m Migration) Checksum() string {
+	return m.darwinMigration().Checksum()
+}
+
+func (m Migration) darwinMigration() darwin.Migration {
+	return darwin.Migration{
+		Version:     m.Version,
+		Description: m.Description,
+		Script:      m.Script,
+	}
+}
+
+// DarwinMigrations converts a migration set to darwin migrations. The down scripts are dropped.
+func DarwinMigrations(migrations []Migration) []darwin.Migration {
+	darwinMigrations := make([]darwin.Migration, len(migrations))
+	for i, migration := range migrations {
+		darwinMigrations[i] = migration.darwinMigration()
+	}
+
+	return darwinMigrations
+}
+
+// FromDarwinMigrations converts darwin migrations to a migration set. The resulting migrations can't be rolled back.
+func FromDarwinMigrations(darwinMigrations []darwin.Migration) []Migration {
+	migrations := make([]Migration, len(darwinMigrations))
+	for i, migration := range darwinMigrations {
+		migrations[i] = Migration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			Script:      migration.Script,
+		}
+	}
+
+	return migrations
+}
+
+// migrationTx is the transaction in which a migration is rolled back
+type migrationTx interface {
+	ExecContext(ctx context.Context, statement string, args ...interface{}) (sql.Result, error)
+	Commit() error
+	Rollback() error
+}
+
+// migrationTarget is the connection the migrations are run on
+type migrationTarget interface {
+	darwin.Driver
+	QueryRow(query string, args ...interface{}) *sql.Row
+	begin() (migrationTx, error)
+	withLock(options MigrationOptions, run func() error) error
+}
+
+// migrationTargetProvider is implemented by the databases which can't run the migrations through a darwin.GenericDriver
+type migrationTargetProvider interface {
+	migrationTarget() migrationTarget
+}
+
+// genericMigrationTarget runs the migrations on a darwin.GenericDriver, each of them in its own transaction
+type genericMigrationTarget struct {
+	*darwin.GenericDriver
+	dialect Dialect
+}
+
+func newMigrationTarget(db WriteDB) migrationTarget {
+	if provider, ok := db.(migrationTargetProvider); ok {
+		return provider.migrationTarget()
+	}
+
+	return &genericMigrationTarget{
+		GenericDriver: db.NewGenericDriver(db.Dialect().MigrationDialect()),
+		dialect:       db.Dialect(),
+	}
+}
+
+func (target *genericMigrationTarget) QueryRow(query string, args ...interface{}) *sql.Row {
+	return target.DB.QueryRow(query, args...)
+}
+
+func (target *genericMigrationTarget) begin() (migrationTx, error) {
+	tx, err := target.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+func (target *genericMigrationTarget) withLock(options MigrationOptions, run func() error) error {
+	return withMigrationLock(target.dialect, target.DB, options, run)
+}
+
 // Migrate is a helper function in charge of running pending migrations
 func Migrate(db WriteDB, migrations []darwin.Migration) error {
-	driver := db.NewGenericDriver(darwin.PostgresDialect{})
+	return MigrateWithOptions(db, FromDarwinMigrations(migrations), MigrationOptions{})
+}
+
+// MigrateWithOptions runs the pending migrations of the migration set
+func MigrateWithOptions(db WriteDB, migrations []Migration, options MigrationOptions) error {
+	target := newMigrationTarget(db)
+
+	if options.DryRun {
+		records, err := appliedMigrations(db.Dialect(), target)
+		if err != nil {
+			return fmt.Errorf("can't migrate: %v", err)
+		}
+
+		if err := validateMigrations(records, migrations); err != nil {
+			return fmt.Errorf("can't migrate: %v", err)
+		}
+
+		for _, info := range migrationsStatus(records, migrations) {
+			if info.Status != MigrationStatusPending {
+				continue
+			}
+
+			migration := findMigration(migrations, info.Version)
+			fmt.Fprintf(options.output(), "-- migrate to version %v: %s\n%s\n\n", migration.Version, migration.Description, strings.TrimSpace(migration.Script))
+		}
+
+		return nil
+	}
+
+	return target.withLock(options, func() error {
+		d := darwin.New(target, DarwinMigrations(migrations), nil)
+
+		if err := d.Migrate(); err != nil {
+			return fmt.Errorf("can't migrate: %v", err)
+		}
+
+		return nil
+	})
+}
+
+// Rollback runs the down scripts of every applied migration more recent than the target version, from the most recent to the oldest.
+// Each migration is rolled back in its own transaction. Nothing is executed if one of them does not define a down script.
+func Rollback(db WriteDB, migrations []Migration, targetVersion float64, options MigrationOptions) error {
+	target := newMigrationTarget(db)
+
+	if options.DryRun {
+		return rollback(db.Dialect(), target, migrations, targetVersion, options)
+	}
+
+	return target.withLock(options, func() error {
+		return rollback(db.Dialect(), target, migrations, targetVersion, options)
+	})
+}
+
+func rollback(dialect Dialect, target migrationTarget, migrations []Migration, targetVersion float64, options MigrationOptions) error {
+	records, err := appliedMigrations(dialect, target)
+	if err != nil {
+		return fmt.Errorf("can't rollback: %v", err)
+	}
+
+	if err := validateMigrations(records, migrations); err != nil {
+		return fmt.Errorf("can't rollback: %v", err)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].Version > records[j].Version })
 
-	d := darwin.New(driver, migrations, nil)
+	var planned []darwin.MigrationRecord
+	for _, record := range records {
+		if record.Version <= targetVersion {
+			break
+		}
 
-	if err := d.Migrate(); err != nil {
-		return fmt.Errorf("can't migrate: %v", err)
+		migration := findMigration(migrations, record.Version)
+		if migration.DownScript == "" {
+			return fmt.Errorf("can't rollback: migration %v has no down script", record.Version)
+		}
+
+		planned = append(planned, record)
+	}
+
+	for _, record := range planned {
+		migration := findMigration(migrations, record.Version)
+
+		if options.DryRun {
+			fmt.Fprintf(options.output(), "-- rollback version %v: %s\n%s\n\n", migration.Version, migration.Description, strings.TrimSpace(migration.DownScript))
+			continue
+		}
+
+		tx, err := target.begin()
+		if err != nil {
+			return fmt.Errorf("can't rollback migration %v: %v", record.Version, err)
+		}
+
+		if _, err := tx.ExecContext(context.Background(), migration.DownScript); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("can't rollback migration %v: %v", record.Version, err)
+		}
+
+		// the version read from the database is used so that the comparison is not affected by the REAL column precision
+		deleteStatement := sqlx.Rebind(sqlx.BindType(dialect.DriverName()), `DELETE FROM darwin_migrations WHERE version = ?`)
+		if _, err := tx.ExecContext(context.Background(), deleteStatement, record.Version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("can't remove migration %v from the applied migrations: %v", record.Version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("can't commit the rollback of migration %v: %v", record.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrationsStatus returns the status of every migration of the migration set as well as the applied migrations missing from the set
+func MigrationsStatus(db WriteDB, migrations []Migration) ([]MigrationInfo, error) {
+	records, err := appliedMigrations(db.Dialect(), newMigrationTarget(db))
+	if err != nil {
+		return nil, fmt.Errorf("can't get the migrations status: %v", err)
+	}
+
+	return migrationsStatus(records, migrations), nil
+}
+
+// RunMigrationCommand is in charge of running a migration command line. The supported commands are:
+// - "up" (or no command at all) which runs the pending migrations
+// - "status" which prints the status of every migration
+// - "rollback <version>" which rolls back every migration more recent than the version
+// The "--dry-run" flag prints the SQL which would be executed by "up" and "rollback" without executing it.
+func RunMigrationCommand(db WriteDB, migrations []Migration, arguments []string, options MigrationOptions) error {
+	var command []string
+
+	for _, argument := range arguments {
+		switch argument {
+		case "--dry-run", "-dry-run":
+			options.DryRun = true
+		default:
+			command = append(command, argument)
+		}
+	}
+
+	if len(command) == 0 {
+		command = []string{"up"}
+	}
+
+	switch command[0] {
+	case "up":
+		return MigrateWithOptions(db, migrations, options)
+
+	case "status":
+		infos, err := MigrationsStatus(db, migrations)
+		if err != nil {
+			return err
+		}
+
+		return printMigrationsStatus(options.output(), infos)
+
+	case "rollback":
+		if len(command) != 2 {
+			return fmt.Errorf("the rollback command expects the target version as its only argument")
+		}
+
+		targetVersion, err := strconv.ParseFloat(command[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid target version %q: %v", command[1], err)
+		}
+
+		return Rollback(db, migrations, targetVersion, options)
+
+	default:
+		return fmt.Errorf("unknown migration command %q: expected one of up, status or rollback", command[0])
+	}
+}
+
+func printMigrationsStatus(output io.Writer, infos []MigrationInfo) error {
+	w := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "VERSION\tSTATUS\tAPPLIED AT\tDESCRIPTION")
+	for _, info := range infos {
+		appliedAt := "-"
+		if info.AppliedAt != nil {
+			appliedAt = info.AppliedAt.UTC().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%v\t%s\t%s\t%s\n", info.Version, info.Status, appliedAt, info.Description)
+	}
+
+	return w.Flush()
+}
+
+// appliedMigrations returns the migrations applied on the database. The darwin table is not created if it does not exist
+// so that read-only operations like dry runs don't alter the database.
+func appliedMigrations(dialect Dialect, target migrationTarget) ([]darwin.MigrationRecord, error) {
+	var exists bool
+
+	row := target.QueryRow(dialect.TableExistsSQL(), "darwin_migrations")
+	if err := row.Scan(&exists); err != nil {
+		return nil, fmt.Errorf("can't check the migrations table: %v", err)
+	}
+
+	if !exists {
+		return nil, nil
+	}
+
+	return target.All()
+}
+
+// validateMigrations makes sure the migration set is consistent with the migrations applied on the database
+func validateMigrations(records []darwin.MigrationRecord, migrations []Migration) error {
+	versions := make(map[float64]bool)
+
+	for _, migration := range migrations {
+		if migration.Version < 0 {
+			return darwin.IllegalMigrationVersionError{Version: migration.Version}
+		}
+
+		if versions[migration.Version] {
+			return darwin.DuplicateMigrationVersionError{Version: migration.Version}
+		}
+
+		versions[migration.Version] = true
+	}
+
+	for _, info := range migrationsStatus(records, migrations) {
+		switch info.Status {
+		case MigrationStatusMissing:
+			return darwin.RemovedMigrationError{Version: info.Version}
+		case MigrationStatusChecksumMismatch:
+			return darwin.InvalidChecksumError{Version: info.Version}
+		}
 	}
 
 	return nil
 }
+
+func migrationsStatus(records []darwin.MigrationRecord, migrations []Migration) []MigrationInfo {
+	var lastAppliedVersion float64 = -1
+
+	applied := make(map[float64]darwin.MigrationRecord)
+	for _, record := range records {
+		applied[record.Version] = record
+
+		if record.Version > lastAppliedVersion {
+			lastAppliedVersion = record.Version
+		}
+	}
+
+	infos := make([]MigrationInfo, 0, len(migrations))
+	known := make(map[float64]bool)
+
+	for _, migration := range migrations {
+		known[migration.Version] = true
+
+		info := MigrationInfo{
+			Version:     migration.Version,
+			Description: migration.Description,
+		}
+
+		record, ok := applied[migration.Version]
+		switch {
+		case ok && record.Checksum != migration.Checksum():
+			info.Status = MigrationStatusChecksumMismatch
+		case ok:
+			info.Status = MigrationStatusApplied
+		case migration.Version > lastAppliedVersion:
+			info.Status = MigrationStatusPending
+		default:
+			info.Status = MigrationStatusIgnored
+		}
+
+		if ok {
+			appliedAt := record.AppliedAt
+			info.AppliedAt = &appliedAt
+		}
+
+		infos = append(infos, info)
+	}
+
+	for _, record := range records {
+		if known[record.Version] {
+			continue
+		}
+
+		appliedAt := record.AppliedAt
+		infos = append(infos, MigrationInfo{
+			Version:     record.Version,
+			Description: record.Description,
+			Status:      MigrationStatusMissing,
+			AppliedAt:   &appliedAt,
+		})
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].Version < infos[j].Version })
+
+	return infos
+}
+
+func findMigration(migrations []Migration, version float64) Migration {
+	for _, migration := range migrations {
+		if migration.Version == version {
+			return migration
+		}
+	}
+
+	return Migration{Version: version}
+}
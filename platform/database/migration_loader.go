@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_\-]+)\.(up|down)\.sql$`)
+
+// migrationFiles keeps track of the files defining one migration version
+type migrationFiles struct {
+	up        string
+	down      string
+	migration Migration
+}
+
+// LoadMigrations reads the migrations stored as SQL files in a directory of the file system, typically an embed.FS.
+// The files must be named like `0001_create_users.up.sql`. A `0001_create_users.down.sql` file can be provided to
+// define how to roll the migration back. Files which do not end with `.sql` are ignored.
+// Versions must be unique and contiguous, any duplicate or gap is reported as an error.
+// The resulting migrations can be run with MigrateWithOptions or converted for Migrate with DarwinMigrations.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the migrations directory %s: %v", dir, err)
+	}
+
+	byVersion := make(map[int]*migrationFiles)
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		matches := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name %s: expected a name like 0001_description.up.sql or 0001_description.down.sql", entry.Name())
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", entry.Name(), err)
+		}
+
+		if version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s: versions must start at 1", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("can't read migration file %s: %v", entry.Name(), err)
+		}
+
+		files, ok := byVersion[version]
+		if !ok {
+			files = &migrationFiles{migration: Migration{
+				Version:     float64(version),
+				Description: strings.ReplaceAll(matches[2], "_", " "),
+			}}
+			byVersion[version] = files
+		}
+
+		switch matches[3] {
+		case "up":
+			if files.up != "" {
+				return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, files.up, entry.Name())
+			}
+
+			files.up = entry.Name()
+			files.migration.Script = string(content)
+
+		case "down":
+			if files.down != "" {
+				return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, files.down, entry.Name())
+			}
+
+			files.down = entry.Name()
+			files.migration.DownScript = string(content)
+		}
+	}
+
+	versions := make([]int, 0, len(byVersion))
+	for version, files := range byVersion {
+		if files.up == "" {
+			return nil, fmt.Errorf("migration version %d has a down script %s but no up script", version, files.down)
+		}
+
+		if files.down != "" && strings.TrimSuffix(files.up, ".up.sql") != strings.TrimSuffix(files.down, ".down.sql") {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s do not describe the same migration", version, files.up, files.down)
+		}
+
+		versions = append(versions, version)
+	}
+
+	sort.Ints(versions)
+
+	migrations := make([]Migration, 0, len(versions))
+	for i, version := range versions {
+		if i > 0 && version != versions[i-1]+1 {
+			return nil, fmt.Errorf("gap in the migration versions: %s is followed by %s, expected version %d", byVersion[versions[i-1]].up, byVersion[version].up, versions[i-1]+1)
+		}
+
+		migrations = append(migrations, byVersion[version].migration)
+	}
+
+	return migrations, nil
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/logging"
+)
+
+// DefaultMigrationLockTimeout is the time an instance waits for another instance to finish running the migrations
+var DefaultMigrationLockTimeout = 5 * time.Minute
+
+const migrationLockPollInterval = time.Second
+
+// migrationLockKey identifies the Postgres advisory lock taken while migrating
+var migrationLockKey = LockKey("github.com/fewlinesco/go-pkg/platform/database.migrations")
+
+// lockHolderQuery describes the session holding a bigint advisory lock. Postgres splits the key in two 32 bits
+// halves which are stored in the classid and objid columns.
+const lockHolderQuery = `
+	SELECT
+		a.pid,
+		COALESCE(a.application_name, ''),
+		COALESCE(host(a.client_addr), ''),
+		a.backend_start
+	FROM pg_locks l
+	JOIN pg_stat_activity a ON a.pid = l.pid
+	WHERE l.locktype = 'advisory'
+		AND l.granted
+		AND l.objsubid = 1
+		AND l.classid = (($1::bigint >> 32) & 4294967295)::oid
+		AND l.objid = ($1::bigint & 4294967295)::oid
+	LIMIT 1`
+
+func (options MigrationOptions) lockTimeout() time.Duration {
+	if options.LockTimeout <= 0 {
+		return DefaultMigrationLockTimeout
+	}
+
+	return options.LockTimeout
+}
+
+func (options MigrationOptions) logger() *logging.Logger {
+	if options.Logger != nil {
+		return options.Logger
+	}
+
+	logger, err := logging.NewDefaultLogger()
+	if err != nil {
+		return nil
+	}
+
+	return logger
+}
+
+// withMigrationLock runs the callback while holding the migration advisory lock so that only one instance migrates the
+// database at a time. The lock is held by a dedicated connection and is released when the callback returns.
+// Advisory locks are specific to Postgres, the callback is run without lock for other engines.
+func withMigrationLock(dialect Dialect, db *sql.DB, options MigrationOptions, run func() error) error {
+	if _, ok := dialect.(PostgresDialect); !ok {
+		return run()
+	}
+
+	ctx := context.Background()
+	logger := options.logger()
+	timeout := options.lockTimeout()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get a connection for the migration lock: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	lastHolder := ""
+
+	for {
+		var acquired bool
+		if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, migrationLockKey).Scan(&acquired); err != nil {
+			discardConn(conn)
+			return fmt.Errorf("can't acquire the migration lock: %v", err)
+		}
+
+		if acquired {
+			break
+		}
+
+		holder := describeLockHolder(ctx, conn, migrationLockKey)
+		if time.Now().After(deadline) {
+			return fmt.Errorf("can't acquire the migration lock within %v: it is held by %s", timeout, holder)
+		}
+
+		if holder != lastHolder && logger != nil {
+			logger.Printf("waiting for the migration lock held by %s", holder)
+			lastHolder = holder
+		}
+
+		time.Sleep(migrationLockPollInterval)
+	}
+
+	if logger != nil {
+		logger.Println("migration lock acquired")
+	}
+
+	defer func() {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey); err != nil {
+			// the connection would go back to the pool with the lock, it is closed for the server to release it
+			discardConn(conn)
+
+			if logger != nil {
+				logger.Printf("can't release the migration lock, its connection has been closed for the server to release it: %v", err)
+			}
+
+			return
+		}
+
+		if logger != nil {
+			logger.Println("migration lock released")
+		}
+	}()
+
+	return run()
+}
+
+func describeLockHolder(ctx context.Context, conn *sql.Conn, key int64) string {
+	var (
+		pid             int
+		applicationName string
+		clientAddress   string
+		backendStart    time.Time
+	)
+
+	err := conn.QueryRowContext(ctx, lockHolderQuery, key).Scan(&pid, &applicationName, &clientAddress, &backendStart)
+	if err == sql.ErrNoRows {
+		return "a session which just released it"
+	}
+
+	if err != nil {
+		return fmt.Sprintf("an unknown session (%v)", err)
+	}
+
+	if applicationName == "" {
+		applicationName = "unknown"
+	}
+
+	if clientAddress == "" {
+		clientAddress = "local"
+	}
+
+	return fmt.Sprintf("pid %d (application: %s, client: %s, connected since %s)", pid, applicationName, clientAddress, backendStart.UTC().Format(time.RFC3339))
+}
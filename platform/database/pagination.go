@@ -0,0 +1,322 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+// errInvalidCursor is returned when a cursor can't be decoded, has not been signed with the paginator secret or was
+// created for another sort order
+var errInvalidCursor = errors.New("invalid pagination cursor")
+
+const (
+	cursorDirectionNext     = "next"
+	cursorDirectionPrevious = "previous"
+)
+
+// SortKey is a column of the base query used to order the pages. The sort keys of a query must identify a row, which
+// is usually achieved by using the primary key as the last sort key.
+// Field is the name of the column in the struct tags of the destination and defaults to Column.
+type SortKey struct {
+	Column     string
+	Field      string
+	Descending bool
+}
+
+func (key SortKey) field() string {
+	if key.Field != "" {
+		return key.Field
+	}
+
+	return key.Column
+}
+
+// PageQuery describes the page to fetch. Query is the base query without ORDER BY nor LIMIT, its placeholders must
+// be question marks since they are rebound for the driver once the keyset condition has been added.
+type PageQuery struct {
+	Query    string
+	Args     []interface{}
+	SortKeys []SortKey
+	Limit    int
+	Cursor   string
+}
+
+// Page describes the cursors of the pages around a fetched page. A cursor is empty when there is no such page.
+type Page struct {
+	Next     string
+	Previous string
+}
+
+// Paginator runs keyset paginated queries and signs their cursors so that clients can't forge them
+type Paginator struct {
+	secret []byte
+	mapper *reflectx.Mapper
+}
+
+// cursor is the content of a cursor token: the sort key values of the row the page starts after
+type cursor struct {
+	Direction string        `json:"d"`
+	SortKeys  string        `json:"k"`
+	Values    []cursorValue `json:"v"`
+}
+
+// cursorValue keeps the times apart so that they are decoded as times rather than strings
+type cursorValue struct {
+	Time  *time.Time  `json:"t,omitempty"`
+	Value interface{} `json:"v,omitempty"`
+}
+
+func newCursorValue(value interface{}) cursorValue {
+	if t, ok := value.(time.Time); ok {
+		return cursorValue{Time: &t}
+	}
+
+	return cursorValue{Value: value}
+}
+
+func (value cursorValue) value() interface{} {
+	if value.Time != nil {
+		return *value.Time
+	}
+
+	if number, ok := value.Value.(json.Number); ok {
+		if i, err := number.Int64(); err == nil {
+			return i
+		}
+
+		if f, err := number.Float64(); err == nil {
+			return f
+		}
+	}
+
+	return value.Value
+}
+
+// NewPaginator creates a paginator signing the cursors with the secret. The destinations of the queries are mapped
+// with the `db` struct tags like sqlx does.
+func NewPaginator(secret []byte) *Paginator {
+	return &Paginator{
+		secret: secret,
+		mapper: reflectx.NewMapperFunc("db", strings.ToLower),
+	}
+}
+
+// SelectPage fetches a page of the query in dest, which must be a pointer to a slice of structs, and returns the
+// cursors of the next and previous pages. An invalid cursor is reported as a wrapped web.Error so that handlers can
+// return it as is.
+func (paginator *Paginator) SelectPage(ctx context.Context, db ReadDB, dest interface{}, query PageQuery) (Page, error) {
+	if len(query.SortKeys) == 0 {
+		return Page{}, fmt.Errorf("can't paginate: at least one sort key is required")
+	}
+
+	if query.Limit <= 0 {
+		return Page{}, fmt.Errorf("can't paginate: the limit must be positive")
+	}
+
+	sortKeys := sortKeysFingerprint(query.SortKeys)
+
+	position := cursor{Direction: cursorDirectionNext, SortKeys: sortKeys}
+	if query.Cursor != "" {
+		decoded, err := paginator.decodeCursor(query.Cursor)
+		if err == nil && (decoded.SortKeys != sortKeys || len(decoded.Values) != len(query.SortKeys)) {
+			err = errInvalidCursor
+		}
+
+		if err != nil {
+			return Page{}, fmt.Errorf("%w", web.NewErrInvalidPagination(web.ErrorDetails{"cursor": err.Error()}))
+		}
+
+		position = decoded
+	}
+
+	backward := position.Direction == cursorDirectionPrevious
+
+	statement, args := keysetQuery(query, position.Values, backward)
+	statement = sqlx.Rebind(sqlx.BindType(db.Dialect().DriverName()), statement)
+
+	if err := db.SelectContext(ctx, dest, statement, args...); err != nil {
+		return Page{}, fmt.Errorf("can't select page: %v", err)
+	}
+
+	items := reflect.ValueOf(dest).Elem()
+
+	hasMore := items.Len() > query.Limit
+	if hasMore {
+		items.Set(items.Slice(0, query.Limit))
+	}
+
+	if backward {
+		for i, j := 0, items.Len()-1; i < j; i, j = i+1, j-1 {
+			first, last := items.Index(i).Interface(), items.Index(j).Interface()
+			items.Index(i).Set(reflect.ValueOf(last))
+			items.Index(j).Set(reflect.ValueOf(first))
+		}
+	}
+
+	var page Page
+	if items.Len() == 0 {
+		return page, nil
+	}
+
+	hasNext, hasPrevious := hasMore, query.Cursor != ""
+	if backward {
+		hasNext, hasPrevious = true, hasMore
+	}
+
+	if hasNext {
+		token, err := paginator.itemCursor(items.Index(items.Len()-1), cursorDirectionNext, query.SortKeys)
+		if err != nil {
+			return Page{}, err
+		}
+
+		page.Next = token
+	}
+
+	if hasPrevious {
+		token, err := paginator.itemCursor(items.Index(0), cursorDirectionPrevious, query.SortKeys)
+		if err != nil {
+			return Page{}, err
+		}
+
+		page.Previous = token
+	}
+
+	return page, nil
+}
+
+// keysetQuery wraps the base query to select the rows after (or before when going backward) the cursor values.
+// The condition is expanded as `(a > ?) OR (a = ? AND b > ?)` so that each sort key can have its own direction.
+func keysetQuery(query PageQuery, values []cursorValue, backward bool) (string, []interface{}) {
+	args := append([]interface{}{}, query.Args...)
+
+	var statement strings.Builder
+	fmt.Fprintf(&statement, "SELECT * FROM (%s) AS page", query.Query)
+
+	if len(values) > 0 {
+		var conditions []string
+
+		for i, key := range query.SortKeys {
+			var parts []string
+
+			for j := 0; j < i; j++ {
+				parts = append(parts, fmt.Sprintf("%s = ?", query.SortKeys[j].Column))
+				args = append(args, values[j].value())
+			}
+
+			operator := ">"
+			if key.Descending != backward {
+				operator = "<"
+			}
+
+			parts = append(parts, fmt.Sprintf("%s %s ?", key.Column, operator))
+			args = append(args, values[i].value())
+
+			conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+		}
+
+		fmt.Fprintf(&statement, " WHERE %s", strings.Join(conditions, " OR "))
+	}
+
+	orders := make([]string, len(query.SortKeys))
+	for i, key := range query.SortKeys {
+		direction := "ASC"
+		if key.Descending != backward {
+			direction = "DESC"
+		}
+
+		orders[i] = fmt.Sprintf("%s %s", key.Column, direction)
+	}
+
+	fmt.Fprintf(&statement, " ORDER BY %s LIMIT %d", strings.Join(orders, ", "), query.Limit+1)
+
+	return statement.String(), args
+}
+
+func sortKeysFingerprint(sortKeys []SortKey) string {
+	keys := make([]string, len(sortKeys))
+	for i, key := range sortKeys {
+		keys[i] = key.Column
+		if key.Descending {
+			keys[i] = "-" + key.Column
+		}
+	}
+
+	return strings.Join(keys, ",")
+}
+
+func (paginator *Paginator) itemCursor(item reflect.Value, direction string, sortKeys []SortKey) (string, error) {
+	values := make([]cursorValue, len(sortKeys))
+
+	for i, key := range sortKeys {
+		field := paginator.mapper.FieldByName(reflect.Indirect(item), key.field())
+		if !field.IsValid() {
+			return "", fmt.Errorf("can't paginate: the destination has no field mapped to the sort key %s", key.field())
+		}
+
+		values[i] = newCursorValue(field.Interface())
+	}
+
+	return paginator.encodeCursor(cursor{Direction: direction, SortKeys: sortKeysFingerprint(sortKeys), Values: values})
+}
+
+func (paginator *Paginator) encodeCursor(c cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("can't encode the cursor: %v", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(paginator.sign(payload)), nil
+}
+
+func (paginator *Paginator) decodeCursor(token string) (cursor, error) {
+	var c cursor
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return c, errInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return c, errInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, paginator.sign(payload)) {
+		return c, errInvalidCursor
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&c); err != nil {
+		return c, errInvalidCursor
+	}
+
+	if c.Direction != cursorDirectionNext && c.Direction != cursorDirectionPrevious {
+		return c, errInvalidCursor
+	}
+
+	return c, nil
+}
+
+func (paginator *Paginator) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, paginator.secret)
+	mac.Write(payload)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+// RateLimitsTable is the table the RateLimitStore keeps the token buckets in
+const RateLimitsTable = "rate_limits"
+
+// RateLimitsMigration creates the table of the RateLimitStore. The update time of the buckets is stored in nanoseconds
+// since the epoch so that the refill is computed the same way whatever the dialect.
+func RateLimitsMigration(version float64) Migration {
+	return Migration{
+		Version:     version,
+		Description: "Create the rate limits",
+		Script: fmt.Sprintf(`
+			CREATE TABLE %[1]s (
+				rate_key TEXT PRIMARY KEY,
+				tokens DOUBLE PRECISION NOT NULL,
+				updated_at BIGINT NOT NULL
+			);
+
+			CREATE INDEX %[1]s_updated_at_idx ON %[1]s (updated_at)`, RateLimitsTable),
+		DownScript: fmt.Sprintf(`DROP TABLE %s`, RateLimitsTable),
+	}
+}
+
+// RateLimitStore is a web.RateLimitStore keeping the token buckets in the RateLimitsTable so that the requests are
+// limited across all the instances of a service. The buckets are refilled with the clock of the database, which keeps
+// the instances from disagreeing on the time, and each request refills its bucket before reading it so that the bucket
+// is locked for the rest of the transaction, whatever the dialect.
+type RateLimitStore struct {
+	db DB
+}
+
+// NewRateLimitStore returns a store keeping the buckets in the database
+func NewRateLimitStore(db DB) *RateLimitStore {
+	return &RateLimitStore{db: db}
+}
+
+type rateLimitBucket struct {
+	Tokens    float64 `db:"tokens"`
+	UpdatedAt int64   `db:"updated_at"`
+}
+
+// rateLimitSQL holds the expressions of a dialect used by the statements of the store
+type rateLimitSQL struct {
+	// now is the current time of the database in nanoseconds since the epoch
+	now string
+	// least and greatest are the functions returning the smallest and the greatest of their arguments
+	least    string
+	greatest string
+}
+
+func (store *RateLimitStore) dialectSQL() rateLimitSQL {
+	if _, ok := store.db.Dialect().(PostgresDialect); ok {
+		return rateLimitSQL{
+			now:      `(EXTRACT(EPOCH FROM clock_timestamp()) * 1000000000)::BIGINT`,
+			least:    "LEAST",
+			greatest: "GREATEST",
+		}
+	}
+
+	return rateLimitSQL{
+		now:      `CAST((julianday('now') - 2440587.5) * 86400000000000 AS INTEGER)`,
+		least:    "MIN",
+		greatest: "MAX",
+	}
+}
+
+func (store *RateLimitStore) rebind(statement string) string {
+	return sqlx.Rebind(sqlx.BindType(store.db.Dialect().DriverName()), statement)
+}
+
+// Take takes a token from the bucket of the key
+func (store *RateLimitStore) Take(ctx context.Context, key string, limit web.RateLimit) (web.RateLimitResult, error) {
+	if err := limit.Validate(); err != nil {
+		return web.RateLimitResult{}, err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return web.RateLimitResult{}, fmt.Errorf("can't begin the rate limit transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	dialect := store.dialectSQL()
+	refillPerNanosecond := float64(limit.Requests) / float64(limit.Period.Nanoseconds())
+
+	// the bucket is written before being read so that it is locked for the rest of the transaction: Postgres locks the
+	// row and SQLite the whole database for writing
+	if _, err := tx.ExecContext(ctx, store.rebind(fmt.Sprintf(`
+		INSERT INTO %[1]s (rate_key, tokens, updated_at) VALUES (?, ?, %[2]s)
+		ON CONFLICT (rate_key) DO UPDATE SET
+			tokens = %[3]s(CAST(? AS DOUBLE PRECISION), %[1]s.tokens + %[4]s(0, %[2]s - %[1]s.updated_at) * CAST(? AS DOUBLE PRECISION)),
+			updated_at = %[4]s(%[1]s.updated_at, %[2]s)`, RateLimitsTable, dialect.now, dialect.least, dialect.greatest)),
+		key, limit.Requests, limit.Requests, refillPerNanosecond); err != nil {
+		return web.RateLimitResult{}, fmt.Errorf("can't refill the rate limit bucket: %v", err)
+	}
+
+	var stored rateLimitBucket
+	if err := tx.GetContext(ctx, &stored, store.rebind(fmt.Sprintf(`SELECT tokens, updated_at FROM %s WHERE rate_key = ?`, RateLimitsTable)), key); err != nil {
+		return web.RateLimitResult{}, fmt.Errorf("can't read the rate limit bucket: %v", err)
+	}
+
+	// the bucket is already refilled, it is taken from at the time it was updated
+	updatedAt := time.Unix(0, stored.UpdatedAt)
+	bucket, result := web.TokenBucket{Tokens: stored.Tokens, UpdatedAt: updatedAt}.Take(limit, updatedAt)
+
+	if result.Allowed {
+		if _, err := tx.ExecContext(ctx, store.rebind(fmt.Sprintf(`UPDATE %s SET tokens = ? WHERE rate_key = ?`, RateLimitsTable)), bucket.Tokens, key); err != nil {
+			return web.RateLimitResult{}, fmt.Errorf("can't update the rate limit bucket: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return web.RateLimitResult{}, fmt.Errorf("can't commit the rate limit bucket: %v", err)
+	}
+
+	return result, nil
+}
+
+// PurgeIdle deletes the buckets which have not been used for the given time and returns how many were deleted. The
+// time should be longer than the period of the rate limits, it is meant to be run periodically.
+func (store *RateLimitStore) PurgeIdle(ctx context.Context, idle time.Duration) (int64, error) {
+	statement := fmt.Sprintf(`DELETE FROM %s WHERE updated_at < %s - ?`, RateLimitsTable, store.dialectSQL().now)
+
+	result, err := store.db.ExecContext(ctx, store.rebind(statement), idle.Nanoseconds())
+	if err != nil {
+		return 0, fmt.Errorf("can't purge the rate limit buckets: %v", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,426 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GuiaBolso/darwin"
+	"go.opencensus.io/trace"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+// ReplicaSetConfig represents the configuration of a set of streaming replicas used for read operations.
+// MaxReplicationLag, EjectionDuration and CheckInterval are expressed in seconds. A MaxReplicationLag of 0 disables the lag check.
+// When Primary is defined, queries are sent to it while every replica is ejected.
+type ReplicaSetConfig struct {
+	Replicas          []Config `json:"replicas"`
+	Primary           *Config  `json:"primary"`
+	MaxReplicationLag int      `json:"max_replication_lag"`
+	EjectionDuration  int      `json:"ejection_duration"`
+	CheckInterval     int      `json:"check_interval"`
+}
+
+// DefaultReplicaSetConfig are the default values for any replica set
+var DefaultReplicaSetConfig = ReplicaSetConfig{
+	MaxReplicationLag: 30,
+	EjectionDuration:  30,
+	CheckInterval:     5,
+}
+
+// ErrNoReplicaAvailable is returned when every replica is ejected and no primary has been configured as a fallback
+var ErrNoReplicaAvailable = errors.New("no database replica available")
+
+// replicationLagQuery returns the replication lag in seconds. A replica which has replayed everything it received is
+// considered up to date even if the primary did not write anything for a while.
+const replicationLagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+type replica struct {
+	name string
+	db   *prodDB
+
+	mutex        sync.Mutex
+	ejectedUntil time.Time
+	lastError    error
+}
+
+type replicaSetDB struct {
+	replicas []*replica
+	primary  *prodDB
+	config   ReplicaSetConfig
+	next     uint32
+	done     chan struct{}
+	stop     sync.Once
+	wg       sync.WaitGroup
+}
+
+// ConnectReadReplicas creates a new database meant for read operations which load-balances the queries across a set of replicas.
+// Replicas which fail or lag behind are temporarily ejected. It only returns an error when none of the replicas nor the primary can be reached.
+func ConnectReadReplicas(config ReplicaSetConfig) (ReadDB, error) {
+	if len(config.Replicas) == 0 {
+		return nil, fmt.Errorf("can't connect to replicas: at least one replica must be configured")
+	}
+
+	db := &replicaSetDB{
+		config: config,
+		done:   make(chan struct{}),
+	}
+
+	if config.Primary != nil {
+		primary, dialect, err := connect(*config.Primary)
+		if err != nil {
+			return nil, fmt.Errorf("can't connect to primary database: %v", err)
+		}
+
+		db.primary = &prodDB{db: primary, dialect: dialect, timeouts: newStatementTimeouts(*config.Primary)}
+	}
+
+	for i, replicaConfig := range config.Replicas {
+		conn, dialect, err := open(replicaConfig)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("can't open replica %d: %v", i, err)
+		}
+
+		db.replicas = append(db.replicas, &replica{
+			name: fmt.Sprintf("replica-%d", i),
+			db:   &prodDB{db: conn, dialect: dialect, timeouts: newStatementTimeouts(replicaConfig)},
+		})
+	}
+
+	db.checkReplicas(context.Background())
+
+	if db.primary == nil && db.availableReplicas() == 0 {
+		err := db.replicas[0].err()
+		db.Close()
+		return nil, fmt.Errorf("can't connect to any replica: %v", err)
+	}
+
+	db.wg.Add(1)
+	go db.monitor()
+
+	return db, nil
+}
+
+func (db *replicaSetDB) ejectionDuration() time.Duration {
+	if db.config.EjectionDuration <= 0 {
+		return time.Duration(DefaultReplicaSetConfig.EjectionDuration) * time.Second
+	}
+
+	return time.Duration(db.config.EjectionDuration) * time.Second
+}
+
+func (db *replicaSetDB) monitor() {
+	defer db.wg.Done()
+
+	interval := time.Duration(db.config.CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Duration(DefaultReplicaSetConfig.CheckInterval) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			db.checkReplicas(ctx)
+			cancel()
+		}
+	}
+}
+
+// checkReplicas pings every replica and ejects the ones which can't be reached or whose replication lag exceeds the limit
+func (db *replicaSetDB) checkReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+
+	for _, r := range db.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+
+			if err := db.checkReplica(ctx, r); err != nil {
+				r.eject(err, db.ejectionDuration())
+				return
+			}
+
+			r.reinstate()
+		}(r)
+	}
+
+	wg.Wait()
+}
+
+func (db *replicaSetDB) checkReplica(ctx context.Context, r *replica) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	if db.config.MaxReplicationLag <= 0 {
+		return nil
+	}
+
+	var lag float64
+	if err := r.db.GetContext(ctx, &lag, replicationLagQuery); err != nil {
+		return fmt.Errorf("can't check replication lag: %v", err)
+	}
+
+	if lag > float64(db.config.MaxReplicationLag) {
+		return fmt.Errorf("replication lag of %.1fs exceeds the limit of %ds", lag, db.config.MaxReplicationLag)
+	}
+
+	return nil
+}
+
+func (db *replicaSetDB) availableReplicas() int {
+	now := time.Now()
+	available := 0
+
+	for _, r := range db.replicas {
+		if r.isAvailable(now) {
+			available++
+		}
+	}
+
+	return available
+}
+
+// pick returns the next available replica in a round-robin fashion. The returned replica is nil when the primary is used as a fallback.
+func (db *replicaSetDB) pick() (*replica, *prodDB, error) {
+	now := time.Now()
+	start := atomic.AddUint32(&db.next, 1)
+
+	for i := range db.replicas {
+		r := db.replicas[(int(start)+i)%len(db.replicas)]
+		if r.isAvailable(now) {
+			return r, r.db, nil
+		}
+	}
+
+	if db.primary != nil {
+		return nil, db.primary, nil
+	}
+
+	return nil, nil, ErrNoReplicaAvailable
+}
+
+// run executes the query on an available replica. Read queries are safe to retry so a replica failing because of its
+// connection is ejected and the query is sent to the next one.
+func (db *replicaSetDB) run(query func(*prodDB) error) error {
+	var err error
+
+	for attempt := 0; attempt <= len(db.replicas); attempt++ {
+		r, target, pickErr := db.pick()
+		if pickErr != nil {
+			if err != nil {
+				return err
+			}
+			return pickErr
+		}
+
+		err = query(target)
+		if r == nil || !isConnectionError(err) {
+			return err
+		}
+
+		r.eject(err, db.ejectionDuration())
+	}
+
+	return err
+}
+
+// isConnectionError reports whether the error is caused by the connection to the server rather than by the query itself
+func isConnectionError(err error) bool {
+	e := Classify(err)
+
+	return e != nil && e.Kind == ErrorKindConnectionLost
+}
+
+func (r *replica) isAvailable(now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return !now.Before(r.ejectedUntil)
+}
+
+func (r *replica) eject(err error, duration time.Duration) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.ejectedUntil = time.Now().Add(duration)
+	r.lastError = err
+}
+
+// reinstate puts the replica back in rotation once its ejection period is over
+func (r *replica) reinstate() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Now().Before(r.ejectedUntil) {
+		return
+	}
+
+	r.lastError = nil
+}
+
+func (r *replica) err() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.lastError
+}
+
+// NewGenericDriver creates a darwin driver on the primary database if any, or on the first replica otherwise
+func (db *replicaSetDB) NewGenericDriver(dialect darwin.Dialect) *darwin.GenericDriver {
+	if db.primary != nil {
+		return db.primary.NewGenericDriver(dialect)
+	}
+
+	return db.replicas[0].db.NewGenericDriver(dialect)
+}
+
+// Dialect returns the dialect of the SQL engine the replicas are running
+func (db *replicaSetDB) Dialect() Dialect {
+	return db.replicas[0].db.Dialect()
+}
+
+// Begin starts a new transaction on an available replica. The whole transaction is run on this replica.
+func (db *replicaSetDB) Begin() (Tx, error) {
+	var tx Tx
+
+	err := db.run(func(target *prodDB) error {
+		var err error
+		tx, err = target.Begin()
+		return err
+	})
+
+	return tx, err
+}
+
+// Close stops the replicas monitoring and closes every connection
+func (db *replicaSetDB) Close() error {
+	db.stop.Do(func() { close(db.done) })
+	db.wg.Wait()
+
+	var errs []string
+
+	for _, r := range db.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", r.name, err))
+		}
+	}
+
+	if db.primary != nil {
+		if err := db.primary.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("primary: %v", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("unable to close database connections: %s", strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// SelectContext fetches a slice of elements from an available replica.
+func (db *replicaSetDB) SelectContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
+	return db.run(func(target *prodDB) error {
+		return target.SelectContext(ctx, dest, statement, args...)
+	})
+}
+
+// SelectMultipleContext fetches a slice of elements which match any value from a list from an available replica.
+func (db *replicaSetDB) SelectMultipleContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
+	return db.run(func(target *prodDB) error {
+		return target.SelectMultipleContext(ctx, dest, statement, args...)
+	})
+}
+
+// GetContext fetches one element from an available replica.
+func (db *replicaSetDB) GetContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
+	return db.run(func(target *prodDB) error {
+		return target.GetContext(ctx, dest, statement, args...)
+	})
+}
+
+// PingContext pings an available replica, or the primary when every replica is ejected
+func (db *replicaSetDB) PingContext(ctx context.Context) error {
+	return db.run(func(target *prodDB) error {
+		return target.PingContext(ctx)
+	})
+}
+
+// HealthCheck checks every replica and reports their states in the metadata. The replica set is degraded as long as at
+// least one replica, or the primary, is still working.
+func (db *replicaSetDB) HealthCheck(dbName string) web.HealthzChecker {
+	spanName := fmt.Sprintf("%s.HealthChecker", dbName)
+	description := fmt.Sprintf("Check the availability of the service's %s replicas", dbName)
+
+	return func(ctx context.Context) web.HealthzStatus {
+		ctx, span := trace.StartSpan(ctx, spanName)
+		defer span.End()
+
+		db.checkReplicas(ctx)
+
+		service := web.HealthzStatus{
+			Type:        "Database",
+			Description: description,
+			State:       web.HealthzStateHealthy,
+			Metadata:    make(map[string]string),
+		}
+
+		now := time.Now()
+		available := 0
+		var errs []string
+
+		for _, r := range db.replicas {
+			if r.isAvailable(now) {
+				available++
+				service.Metadata[r.name] = string(web.HealthzStateHealthy)
+				continue
+			}
+
+			err := r.err()
+			service.Metadata[r.name] = string(web.HealthzStateUnhealthy)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", r.name, err))
+			}
+		}
+
+		if len(errs) > 0 {
+			service.Error = strings.Join(errs, ", ")
+			span.AddAttributes(trace.StringAttribute("database-health-error", service.Error))
+		}
+
+		switch {
+		case available == len(db.replicas):
+			return service
+
+		case available > 0:
+			service.State = web.HealthzStateDegraded
+
+		case db.primary != nil && db.primary.PingContext(ctx) == nil:
+			service.State = web.HealthzStateDegraded
+			service.Metadata["primary"] = string(web.HealthzStateHealthy)
+
+		default:
+			service.State = web.HealthzStateUnhealthy
+		}
+
+		return service
+	}
+}
@@ -3,25 +3,44 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/GuiaBolso/darwin"
 	"github.com/jmoiron/sqlx"
 )
 
 type sandboxDB struct {
-	db *sqlx.DB
-	tx *sqlx.Tx
+	db       *sqlx.DB
+	tx       *sqlx.Tx
+	dialect  Dialect
+	timeouts statementTimeouts
+
+	// savepoints is the stack of the savepoints emulating the transactions which are still running
+	savepointsMutex sync.Mutex
+	savepoints      []string
+	savepointsCount int
+
+	// sessionSettingNames are the names of the session settings applied by the statements run so far
+	sessionMutex        sync.Mutex
+	sessionSettingNames map[string]bool
 }
 
+// errSavepointOutOfOrder is returned when a sandbox transaction is ended before a nested one
+var errSavepointOutOfOrder = errors.New("sandbox transactions must be ended in the reverse order they were begun")
+
 type sandboxTx struct {
+	db                    *sandboxDB
 	tx                    *sqlx.Tx
+	savepoint             string
 	rollBackedOrCommitted bool
+	sessionStarted        bool
 }
 
 // SandboxConnect returns a sandboxed database connection from the given configuration
 func SandboxConnect(config Config) (DB, error) {
-	db, err := connect(config)
+	db, dialect, err := connect(config)
 	if err != nil {
 		return nil, fmt.Errorf("can't connect to database: %v", err)
 	}
@@ -32,14 +51,16 @@ func SandboxConnect(config Config) (DB, error) {
 	}
 
 	return &sandboxDB{
-		db: db,
-		tx: tx,
+		db:       db,
+		tx:       tx,
+		dialect:  dialect,
+		timeouts: newStatementTimeouts(config),
 	}, nil
 }
 
 // SandboxReadWriteConnect returns a sandboxed read and write database from the given configuration
 func SandboxReadWriteConnect(config Config) (ReadDB, WriteDB, error) {
-	db, err := connect(config)
+	db, dialect, err := connect(config)
 	if err != nil {
 		return nil, nil, fmt.Errorf("can't connect to database: %v", err)
 	}
@@ -50,8 +71,10 @@ func SandboxReadWriteConnect(config Config) (ReadDB, WriteDB, error) {
 	}
 
 	connection := &sandboxDB{
-		db: db,
-		tx: tx,
+		db:       db,
+		tx:       tx,
+		dialect:  dialect,
+		timeouts: newStatementTimeouts(config),
 	}
 
 	return connection, connection, nil
@@ -70,19 +93,96 @@ func (db *sandboxDB) Close() error {
 }
 
 func (db *sandboxDB) NewGenericDriver(dialect darwin.Dialect) *darwin.GenericDriver {
-	panic("test database cannot produce a darwin driver")
+	panic("test database cannot produce a darwin driver, Migrate and MigrateWithOptions run the migrations inside the sandbox instead")
+}
+
+func (db *sandboxDB) Dialect() Dialect {
+	return db.dialect
 }
 
 func (db *sandboxDB) Begin() (Tx, error) {
-	db.tx.MustExec("SAVEPOINT go_pkg_database_sandbox_savepoint;")
+	db.savepointsMutex.Lock()
+	defer db.savepointsMutex.Unlock()
+
+	db.savepointsCount++
+	savepoint := fmt.Sprintf("go_pkg_database_sandbox_savepoint_%d", db.savepointsCount)
+
+	if _, err := db.tx.Exec(fmt.Sprintf("SAVEPOINT %s;", savepoint)); err != nil {
+		return nil, fmt.Errorf("could not create savepoint (database sandbox transaction begin emulation): %w", err)
+	}
+
+	db.savepoints = append(db.savepoints, savepoint)
+
+	return &sandboxTx{db: db, tx: db.tx, savepoint: savepoint}, nil
+}
+
+// endSavepoint runs the statement ending the innermost savepoint and removes it from the stack. Ending a savepoint
+// which is not the innermost one is refused, as a real transaction can't be ended while a nested one is running.
+func (db *sandboxDB) endSavepoint(savepoint string, statement string) error {
+	db.savepointsMutex.Lock()
+	defer db.savepointsMutex.Unlock()
+
+	if len(db.savepoints) == 0 || db.savepoints[len(db.savepoints)-1] != savepoint {
+		return fmt.Errorf("%w: %s is ended while the transactions begun after it are still running", errSavepointOutOfOrder, savepoint)
+	}
+
+	if _, err := db.tx.Exec(statement); err != nil {
+		return err
+	}
+
+	db.savepoints = db.savepoints[:len(db.savepoints)-1]
+
+	return nil
+}
+
+// applySessionSettings emulates the transactions of a connection pool in the sandbox transaction: the session settings
+// of the context are applied and, when reset is true, the ones applied by the previous statements are cleared as they
+// would not be visible in a new transaction. The statement timeout is reset to the one of the connections.
+func (db *sandboxDB) applySessionSettings(ctx context.Context, reset bool) error {
+	settings, _, err := withStatementTimeout(ctx, db.dialect, db.timeouts)
+	if err != nil {
+		return err
+	}
+
+	db.sessionMutex.Lock()
+	defer db.sessionMutex.Unlock()
+
+	applied := make(SessionSettings, len(settings))
+	for name, value := range settings {
+		applied[name] = value
+	}
+
+	if reset {
+		for name := range db.sessionSettingNames {
+			if _, ok := applied[name]; ok {
+				continue
+			}
+
+			if name == statementTimeoutSetting {
+				applied[name] = formatStatementTimeout(db.timeouts.connection())
+			} else {
+				applied[name] = ""
+			}
+		}
+	}
+
+	if db.sessionSettingNames == nil {
+		db.sessionSettingNames = make(map[string]bool)
+	}
+
+	for name := range settings {
+		db.sessionSettingNames[name] = true
+	}
 
-	return &sandboxTx{tx: db.tx}, nil
+	return applySessionSettings(ctx, db.tx, db.dialect, applied)
 }
 
 func (db *sandboxDB) SelectContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
+	if err := db.applySessionSettings(ctx, true); err != nil {
+		return err
+	}
 
 	return db.tx.SelectContext(ctx, dest, statement, args...)
-
 }
 
 func (db *sandboxDB) SelectMultipleContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
@@ -91,26 +191,36 @@ func (db *sandboxDB) SelectMultipleContext(ctx context.Context, dest interface{}
 		return fmt.Errorf("an error occured whilst preparing the statement: %v", err)
 	}
 
+	if err := db.applySessionSettings(ctx, true); err != nil {
+		return err
+	}
+
 	query = db.tx.Rebind(query)
 	return db.tx.SelectContext(ctx, dest, query, queryArguments...)
 }
 
 func (db *sandboxDB) GetContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
+	if err := db.applySessionSettings(ctx, true); err != nil {
+		return err
+	}
 
 	return db.tx.GetContext(ctx, dest, statement, args...)
-
 }
 
 func (db *sandboxDB) ExecContext(ctx context.Context, statement string, arg ...interface{}) (sql.Result, error) {
+	if err := db.applySessionSettings(ctx, true); err != nil {
+		return nil, err
+	}
 
 	return db.tx.ExecContext(ctx, statement, arg...)
-
 }
 
 func (db *sandboxDB) NamedExecContext(ctx context.Context, statement string, arg interface{}) (sql.Result, error) {
+	if err := db.applySessionSettings(ctx, true); err != nil {
+		return nil, err
+	}
 
 	return db.tx.NamedExecContext(ctx, statement, arg)
-
 }
 
 func (db *sandboxDB) PingContext(ctx context.Context) error {
@@ -119,12 +229,20 @@ func (db *sandboxDB) PingContext(ctx context.Context) error {
 
 }
 
+func (tx *sandboxTx) Dialect() Dialect {
+	return tx.db.dialect
+}
+
 func (tx *sandboxTx) Commit() error {
 	if tx.rollBackedOrCommitted {
 		return fmt.Errorf("transaction has already been rollbacked or commited")
 	}
 
-	_, err := tx.tx.Exec("RELEASE SAVEPOINT go_pkg_database_sandbox_savepoint;")
+	err := tx.db.endSavepoint(tx.savepoint, fmt.Sprintf("RELEASE SAVEPOINT %s;", tx.savepoint))
+	if errors.Is(err, errSavepointOutOfOrder) {
+		return err
+	}
+
 	if err != nil {
 		rollbackErr := tx.Rollback()
 		if rollbackErr != nil {
@@ -143,7 +261,7 @@ func (tx *sandboxTx) Rollback() error {
 		return fmt.Errorf("transaction has already been rollbacked or commited")
 	}
 
-	_, err := tx.tx.Exec("ROLLBACK TO SAVEPOINT go_pkg_database_sandbox_savepoint; RELEASE SAVEPOINT go_pkg_database_sandbox_savepoint;")
+	err := tx.db.endSavepoint(tx.savepoint, fmt.Sprintf("ROLLBACK TO SAVEPOINT %[1]s; RELEASE SAVEPOINT %[1]s;", tx.savepoint))
 	if err != nil {
 		return fmt.Errorf("could not rollback to savepoint (database sandbox transaction rollback emulation) %w", err)
 	}
@@ -153,20 +271,43 @@ func (tx *sandboxTx) Rollback() error {
 	return nil
 }
 
+// applySessionSettings clears the settings of the previous statements on the first statement of the transaction only,
+// the next ones keep the settings applied in the transaction
+func (tx *sandboxTx) applySessionSettings(ctx context.Context) error {
+	reset := !tx.sessionStarted
+	tx.sessionStarted = true
+
+	return tx.db.applySessionSettings(ctx, reset)
+}
+
 func (tx *sandboxTx) SelectContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
+	if err := tx.applySessionSettings(ctx); err != nil {
+		return err
+	}
 
 	return tx.tx.SelectContext(ctx, dest, statement, args...)
-
 }
 
 func (tx *sandboxTx) GetContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error {
+	if err := tx.applySessionSettings(ctx); err != nil {
+		return err
+	}
+
 	return tx.tx.GetContext(ctx, dest, statement, args...)
 }
 
 func (tx *sandboxTx) ExecContext(ctx context.Context, statement string, arg ...interface{}) (sql.Result, error) {
+	if err := tx.applySessionSettings(ctx); err != nil {
+		return nil, err
+	}
+
 	return tx.tx.ExecContext(ctx, statement, arg...)
 }
 
 func (tx *sandboxTx) NamedExecContext(ctx context.Context, statement string, arg interface{}) (sql.Result, error) {
+	if err := tx.applySessionSettings(ctx); err != nil {
+		return nil, err
+	}
+
 	return tx.tx.NamedExecContext(ctx, statement, arg)
 }
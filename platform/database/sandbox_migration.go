@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/GuiaBolso/darwin"
+)
+
+// sandboxMigrationTarget runs the migrations inside the sandbox transaction so that the schema changes vanish along
+// with the data when the sandbox is closed. Each migration is run in its own savepoint.
+type sandboxMigrationTarget struct {
+	db      *sandboxDB
+	dialect darwin.Dialect
+}
+
+func (db *sandboxDB) migrationTarget() migrationTarget {
+	return &sandboxMigrationTarget{db: db, dialect: db.dialect.MigrationDialect()}
+}
+
+func (target *sandboxMigrationTarget) transaction(run func(tx Tx) error) error {
+	tx, err := target.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := run(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("%v (and the savepoint could not be rollbacked: %v)", err, rollbackErr)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Create creates the darwin table if needed
+func (target *sandboxMigrationTarget) Create() error {
+	return target.transaction(func(tx Tx) error {
+		_, err := tx.ExecContext(context.Background(), target.dialect.CreateTableSQL())
+		return err
+	})
+}
+
+// Insert records an applied migration
+func (target *sandboxMigrationTarget) Insert(record darwin.MigrationRecord) error {
+	return target.transaction(func(tx Tx) error {
+		_, err := tx.ExecContext(context.Background(), target.dialect.InsertSQL(),
+			record.Version,
+			record.Description,
+			record.Checksum,
+			record.AppliedAt.Unix(),
+			record.ExecutionTime,
+		)
+		return err
+	})
+}
+
+// All returns the applied migrations
+func (target *sandboxMigrationTarget) All() ([]darwin.MigrationRecord, error) {
+	rows, err := target.db.tx.Query(target.dialect.AllSQL())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []darwin.MigrationRecord
+
+	for rows.Next() {
+		var (
+			record        darwin.MigrationRecord
+			appliedAt     int64
+			executionTime float64
+		)
+
+		if err := rows.Scan(&record.Version, &record.Description, &record.Checksum, &appliedAt, &executionTime); err != nil {
+			return nil, err
+		}
+
+		record.AppliedAt = time.Unix(appliedAt, 0)
+		record.ExecutionTime = time.Duration(executionTime)
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// Exec runs a migration script
+func (target *sandboxMigrationTarget) Exec(script string) (time.Duration, error) {
+	start := time.Now()
+
+	err := target.transaction(func(tx Tx) error {
+		_, err := tx.ExecContext(context.Background(), script)
+		return err
+	})
+
+	return time.Since(start), err
+}
+
+func (target *sandboxMigrationTarget) QueryRow(query string, args ...interface{}) *sql.Row {
+	return target.db.tx.QueryRow(query, args...)
+}
+
+func (target *sandboxMigrationTarget) begin() (migrationTx, error) {
+	return target.db.Begin()
+}
+
+// withLock does not take the migration lock since the sandbox transaction isolates the migrations from other sessions
+func (target *sandboxMigrationTarget) withLock(options MigrationOptions, run func() error) error {
+	return run()
+}
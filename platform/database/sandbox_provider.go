@@ -0,0 +1,194 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// SandboxProvider hands every test its own database so that tests can run with t.Parallel(). The migrations are
+// applied once to a template database which is then cloned with `CREATE DATABASE ... TEMPLATE` for each call to
+// Connect. The clone is dropped when the returned DB is closed. It only supports Postgres and the configured user must
+// be allowed to create databases.
+// A provider is typically created in TestMain and closed once every test of the package has run:
+//
+//	provider = database.NewSandboxProvider(cfg, migrations, database.MigrationOptions{})
+//	code := m.Run()
+//	provider.Close()
+type SandboxProvider struct {
+	config     Config
+	migrations []Migration
+	options    MigrationOptions
+
+	prefix   string
+	template string
+	clones   uint64
+
+	initOnce sync.Once
+	initErr  error
+	// cloneMutex serializes the clones since Postgres refuses to copy a template accessed by another session
+	cloneMutex sync.Mutex
+	admin      *sqlx.DB
+}
+
+// sandboxCloneDB is a database cloned from the template which is dropped when closed
+type sandboxCloneDB struct {
+	*prodDB
+	provider *SandboxProvider
+	name     string
+}
+
+// NewSandboxProvider creates a provider for the database server of the configuration. The database of the
+// configuration is only used to run the `CREATE DATABASE` and `DROP DATABASE` statements.
+func NewSandboxProvider(config Config, migrations []Migration, options MigrationOptions) *SandboxProvider {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(fmt.Sprintf("can't generate the sandbox databases prefix: %v", err))
+	}
+
+	prefix := fmt.Sprintf("sandbox_%s", hex.EncodeToString(suffix))
+
+	return &SandboxProvider{
+		config:     config,
+		migrations: migrations,
+		options:    options,
+		prefix:     prefix,
+		template:   prefix + "_template",
+	}
+}
+
+func (provider *SandboxProvider) init() error {
+	provider.initOnce.Do(func() {
+		admin, dialect, err := connect(provider.config)
+		if err != nil {
+			provider.initErr = fmt.Errorf("can't connect to database: %v", err)
+			return
+		}
+
+		if _, ok := dialect.(PostgresDialect); !ok {
+			admin.Close()
+			provider.initErr = fmt.Errorf("sandbox providers are not supported by the %s driver", dialect.DriverName())
+			return
+		}
+
+		provider.admin = admin
+
+		if _, err := admin.Exec(fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(provider.template))); err != nil {
+			provider.initErr = fmt.Errorf("can't create the template database: %v", err)
+			return
+		}
+
+		template, err := Connect(provider.databaseConfig(provider.template))
+		if err != nil {
+			provider.initErr = fmt.Errorf("can't connect to the template database: %v", err)
+			return
+		}
+		defer template.Close()
+
+		if err := MigrateWithOptions(template, provider.migrations, provider.options); err != nil {
+			provider.initErr = fmt.Errorf("can't migrate the template database: %v", err)
+		}
+	})
+
+	return provider.initErr
+}
+
+func (provider *SandboxProvider) databaseConfig(name string) Config {
+	config := provider.config
+	config.Database = name
+
+	if config.URL != "" {
+		if connectionURL, err := url.Parse(config.URL); err == nil {
+			connectionURL.Path = "/" + name
+			config.URL = connectionURL.String()
+		}
+	}
+
+	return config
+}
+
+// Connect clones the template database, migrating it first if needed, and returns a connection to the clone
+func (provider *SandboxProvider) Connect() (DB, error) {
+	name, err := provider.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	config := provider.databaseConfig(name)
+
+	db, dialect, err := connect(config)
+	if err != nil {
+		provider.drop(name)
+		return nil, fmt.Errorf("can't connect to database: %v", err)
+	}
+
+	return &sandboxCloneDB{
+		prodDB:   &prodDB{db: db, dialect: dialect, timeouts: newStatementTimeouts(config)},
+		provider: provider,
+		name:     name,
+	}, nil
+}
+
+// Clone clones the template database like Connect but returns the configuration of the clone, along with the function
+// dropping it, for the tests opening their own connections, e.g. to check what a SandboxConnect leaves behind. Every
+// connection to the clone must be closed before it is dropped.
+func (provider *SandboxProvider) Clone() (Config, func() error, error) {
+	name, err := provider.clone()
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	return provider.databaseConfig(name), func() error { return provider.drop(name) }, nil
+}
+
+func (provider *SandboxProvider) clone() (string, error) {
+	if err := provider.init(); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s_%d", provider.prefix, atomic.AddUint64(&provider.clones, 1))
+
+	provider.cloneMutex.Lock()
+	_, err := provider.admin.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", pq.QuoteIdentifier(name), pq.QuoteIdentifier(provider.template)))
+	provider.cloneMutex.Unlock()
+
+	if err != nil {
+		return "", fmt.Errorf("can't clone the template database: %v", err)
+	}
+
+	return name, nil
+}
+
+// Close drops the template database. Databases returned by Connect which are still open are not dropped.
+func (provider *SandboxProvider) Close() error {
+	if provider.admin == nil {
+		return nil
+	}
+
+	defer provider.admin.Close()
+
+	return provider.drop(provider.template)
+}
+
+func (provider *SandboxProvider) drop(name string) error {
+	if _, err := provider.admin.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(name))); err != nil {
+		return fmt.Errorf("can't drop the sandbox database %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// Close closes the connections to the clone and drops it
+func (db *sandboxCloneDB) Close() error {
+	if err := db.prodDB.Close(); err != nil {
+		return err
+	}
+
+	return db.provider.drop(db.name)
+}
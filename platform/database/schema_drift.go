@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.opencensus.io/trace"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+// ErrSchemaDrift is returned by VerifySchema when the database does not match the migration set
+var ErrSchemaDrift = errors.New("the database schema does not match the migration set")
+
+// SchemaDrift lists, by version, the differences between the migrations applied on the database and the migration set
+// compiled into the binary
+type SchemaDrift struct {
+	// Pending migrations are not applied yet: the binary is more recent than the database
+	Pending []float64
+	// Ignored migrations are not applied while more recent ones are, they will never be applied
+	Ignored []float64
+	// ChecksumMismatch migrations are applied but their script changed since
+	ChecksumMismatch []float64
+	// Missing migrations are applied but unknown to the binary: the database is more recent than the binary
+	Missing []float64
+}
+
+// CheckSchema compares the migrations applied on the database, versions and checksums, with the migration set
+func CheckSchema(db WriteDB, migrations []Migration) (SchemaDrift, error) {
+	infos, err := MigrationsStatus(db, migrations)
+	if err != nil {
+		return SchemaDrift{}, fmt.Errorf("can't check the schema: %v", err)
+	}
+
+	var drift SchemaDrift
+	for _, info := range infos {
+		switch info.Status {
+		case MigrationStatusPending:
+			drift.Pending = append(drift.Pending, info.Version)
+		case MigrationStatusIgnored:
+			drift.Ignored = append(drift.Ignored, info.Version)
+		case MigrationStatusChecksumMismatch:
+			drift.ChecksumMismatch = append(drift.ChecksumMismatch, info.Version)
+		case MigrationStatusMissing:
+			drift.Missing = append(drift.Missing, info.Version)
+		}
+	}
+
+	return drift, nil
+}
+
+// State is unhealthy when migrations of the binary are not applied as is on the database since its queries can't be
+// expected to work. It is degraded when the database has only been migrated further, which is the case of an instance
+// started from an older image during a deployment: its queries keep working as long as the migrations are backward
+// compatible.
+func (drift SchemaDrift) State() web.HealthzState {
+	switch {
+	case len(drift.Pending) > 0 || len(drift.Ignored) > 0 || len(drift.ChecksumMismatch) > 0:
+		return web.HealthzStateUnhealthy
+	case len(drift.Missing) > 0:
+		return web.HealthzStateDegraded
+	default:
+		return web.HealthzStateHealthy
+	}
+}
+
+// String describes the drift, one status after the other
+func (drift SchemaDrift) String() string {
+	var parts []string
+
+	for _, status := range []struct {
+		status   MigrationStatus
+		versions []float64
+	}{
+		{status: MigrationStatusPending, versions: drift.Pending},
+		{status: MigrationStatusIgnored, versions: drift.Ignored},
+		{status: MigrationStatusChecksumMismatch, versions: drift.ChecksumMismatch},
+		{status: MigrationStatusMissing, versions: drift.Missing},
+	} {
+		if len(status.versions) > 0 {
+			parts = append(parts, fmt.Sprintf("%s: %s", status.status, formatVersions(status.versions)))
+		}
+	}
+
+	if len(parts) == 0 {
+		return "no drift"
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+func formatVersions(versions []float64) string {
+	formatted := make([]string, len(versions))
+	for i, version := range versions {
+		formatted[i] = fmt.Sprintf("%v", version)
+	}
+
+	return strings.Join(formatted, ", ")
+}
+
+// VerifySchema is meant to be called at startup to refuse to start against a database which does not match the
+// migration set. A drift whose state is worse than the tolerated one is reported as a wrapped ErrSchemaDrift:
+// web.HealthzStateHealthy tolerates no drift while web.HealthzStateDegraded tolerates a database migrated further.
+func VerifySchema(db WriteDB, migrations []Migration, tolerated web.HealthzState) error {
+	drift, err := CheckSchema(db, migrations)
+	if err != nil {
+		return err
+	}
+
+	if healthzStateSeverity(drift.State()) > healthzStateSeverity(tolerated) {
+		return fmt.Errorf("%w: %s", ErrSchemaDrift, drift)
+	}
+
+	return nil
+}
+
+func healthzStateSeverity(state web.HealthzState) int {
+	switch state {
+	case web.HealthzStateHealthy:
+		return 0
+	case web.HealthzStateDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// SchemaDriftHealthCheck reports the drift between the database and the migration set, see SchemaDrift.State
+func SchemaDriftHealthCheck(db WriteDB, migrations []Migration) web.HealthzChecker {
+	return func(ctx context.Context) web.HealthzStatus {
+		_, span := trace.StartSpan(ctx, "database.SchemaDriftHealthChecker")
+		defer span.End()
+
+		service := web.HealthzStatus{
+			Type:        "Database",
+			Description: "Check the database schema matches the migrations of the service",
+			State:       web.HealthzStateHealthy,
+		}
+
+		drift, err := CheckSchema(db, migrations)
+		if err != nil {
+			service.Error = err.Error()
+			service.State = web.HealthzStateUnhealthy
+			span.AddAttributes(trace.StringAttribute("database-health-error", service.Error))
+
+			return service
+		}
+
+		service.State = drift.State()
+		if service.State != web.HealthzStateHealthy {
+			service.Error = fmt.Sprintf("%v: %s", ErrSchemaDrift, drift)
+			service.Metadata = map[string]string{}
+
+			for name, versions := range map[string][]float64{
+				"pending":           drift.Pending,
+				"ignored":           drift.Ignored,
+				"checksum_mismatch": drift.ChecksumMismatch,
+				"missing":           drift.Missing,
+			} {
+				if len(versions) > 0 {
+					service.Metadata[name] = formatVersions(versions)
+				}
+			}
+		}
+
+		return service
+	}
+}
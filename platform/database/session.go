@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+const (
+	// TenantIDSetting is the setting holding the tenant of the current request, read by the RLS policies with
+	// `current_setting('app.tenant_id', true)`
+	TenantIDSetting = "app.tenant_id"
+	// UserIDSetting is the setting holding the user of the current request, read by the RLS policies with
+	// `current_setting('app.user_id', true)`
+	UserIDSetting = "app.user_id"
+)
+
+// SessionSettings are run-time settings, such as the identity of the caller, applied to the transactions running a
+// statement with a context holding them. They are only visible in the transaction they are applied to, so that they
+// never leak to another request using the same connection afterwards.
+type SessionSettings map[string]string
+
+type sessionSettingsKey struct{}
+
+// WithSessionSettings returns a copy of the context holding the settings, merged with the ones it already holds
+func WithSessionSettings(ctx context.Context, settings SessionSettings) context.Context {
+	merged := make(SessionSettings)
+	for name, value := range SessionSettingsFromContext(ctx) {
+		merged[name] = value
+	}
+
+	for name, value := range settings {
+		merged[name] = value
+	}
+
+	return context.WithValue(ctx, sessionSettingsKey{}, merged)
+}
+
+// WithTenantID returns a copy of the context holding the tenant as the TenantIDSetting
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return WithSessionSettings(ctx, SessionSettings{TenantIDSetting: tenantID})
+}
+
+// WithUserID returns a copy of the context holding the user as the UserIDSetting
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return WithSessionSettings(ctx, SessionSettings{UserIDSetting: userID})
+}
+
+// SessionSettingsFromContext returns the settings held by the context, or nil if there is none
+func SessionSettingsFromContext(ctx context.Context) SessionSettings {
+	settings, _ := ctx.Value(sessionSettingsKey{}).(SessionSettings)
+
+	return settings
+}
+
+// SessionIdentifier reads the session settings of a request, e.g. the tenant and user of an authenticated request.
+// An error, such as a wrapped web.Error, is returned as is by the handler.
+type SessionIdentifier func(ctx context.Context, r *http.Request, params map[string]string) (SessionSettings, error)
+
+// SessionMiddleware adds the session settings read by the identifier to the context of the handlers so that every
+// statement they run is subject to the RLS policies of the caller
+func SessionMiddleware(identify SessionIdentifier) web.Middleware {
+	return func(before web.Handler) web.Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			settings, err := identify(ctx, r, params)
+			if err != nil {
+				return err
+			}
+
+			if len(settings) > 0 {
+				ctx = WithSessionSettings(ctx, settings)
+			}
+
+			return before(ctx, w, r.WithContext(ctx), params)
+		}
+
+		return h
+	}
+}
+
+// applySessionSettings sets the settings for the current transaction, in a stable order
+func applySessionSettings(ctx context.Context, ext sqlx.ExecerContext, dialect Dialect, settings SessionSettings) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	statement := dialect.SessionSettingSQL()
+	if statement == "" {
+		return fmt.Errorf("can't apply the session settings: the %s dialect does not support them", dialect.DriverName())
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := ext.ExecContext(ctx, statement, name, settings[name]); err != nil {
+			return fmt.Errorf("can't apply the session setting %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
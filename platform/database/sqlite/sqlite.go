@@ -0,0 +1,149 @@
+// Package sqlite registers a SQLite dialect for the database package. It is meant for small tools which do not
+// justify a Postgres instance. Import it for its side effects and set the `driver` of the configuration to `sqlite3`:
+//
+//	import _ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+//
+// The `database` of the configuration is the path of the database file and the `options` are passed as query
+// parameters of the data source name, e.g. `_foreign_keys: "1"`.
+package sqlite
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/GuiaBolso/darwin"
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/mattn/go-sqlite3"
+)
+
+// DriverName is the name of the mattn/go-sqlite3 driver
+const DriverName = "sqlite3"
+
+func init() {
+	database.RegisterDialect(Dialect{})
+}
+
+// Dialect is the dialect used for the `sqlite3` driver
+type Dialect struct{}
+
+// DriverName is the name of the mattn/go-sqlite3 driver
+func (Dialect) DriverName() string {
+	return DriverName
+}
+
+// DataSourceName uses the database file path of the configuration, unless an URL is defined
+func (Dialect) DataSourceName(config database.Config) string {
+	if config.URL != "" {
+		return config.URL
+	}
+
+	if len(config.Options) == 0 {
+		return config.Database
+	}
+
+	options := make(url.Values)
+	for key, value := range config.Options {
+		options.Add(key, value)
+	}
+
+	return config.Database + "?" + options.Encode()
+}
+
+// MigrationDialect returns the darwin SQLite dialect
+func (Dialect) MigrationDialect() darwin.Dialect {
+	return darwin.SqliteDialect{}
+}
+
+// TableExistsSQL checks the existence of a table in the schema of the database file
+func (Dialect) TableExistsSQL() string {
+	return `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`
+}
+
+// SessionSettingSQL returns an empty string as SQLite has no run-time settings
+func (Dialect) SessionSettingSQL() string {
+	return ""
+}
+
+// ReferencedTablesSQL reads the foreign keys of a table with the foreign_key_list pragma
+func (Dialect) ReferencedTablesSQL() string {
+	return `SELECT DISTINCT "table" FROM pragma_foreign_key_list(?)`
+}
+
+// QuoteIdentifier quotes the name with double quotes, e.g. `main.users` becomes `"main"."users"`
+func (Dialect) QuoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// TranslateError converts a sqlite3.Error, even wrapped, to a database.Error. SQLite does not report constraint names in
+// its errors: unique violations use `table.column` (comma separated for composite keys) and check violations use the
+// name of the constraint when it is named in the table definition.
+func (Dialect) TranslateError(err error) *database.Error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return nil
+	}
+
+	e := &database.Error{
+		Kind:    database.ErrorKindOther,
+		Message: sqliteErr.Error(),
+		Err:     err,
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		e.Kind = database.ErrorKindUniqueViolation
+		e.Constraint = detailFromMessage(e.Message)
+		e.Table, e.Column = splitColumn(e.Constraint)
+	case sqlite3.ErrConstraintNotNull:
+		e.Kind = database.ErrorKindNotNullViolation
+		e.Table, e.Column = splitColumn(detailFromMessage(e.Message))
+	case sqlite3.ErrConstraintForeignKey:
+		e.Kind = database.ErrorKindForeignKeyViolation
+	case sqlite3.ErrConstraintCheck:
+		e.Kind = database.ErrorKindCheckViolation
+		e.Constraint = detailFromMessage(e.Message)
+	}
+
+	switch sqliteErr.Code {
+	case sqlite3.ErrPerm, sqlite3.ErrReadonly, sqlite3.ErrAuth:
+		e.Kind = database.ErrorKindInsufficientPrivilege
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		e.Kind = database.ErrorKindTimeout
+	case sqlite3.ErrIoErr, sqlite3.ErrCantOpen, sqlite3.ErrNotADB:
+		e.Kind = database.ErrorKindConnectionLost
+	}
+
+	return e
+}
+
+// detailFromMessage extracts what follows `constraint failed: ` in a SQLite error message
+func detailFromMessage(message string) string {
+	const marker = "constraint failed: "
+
+	index := strings.Index(message, marker)
+	if index == -1 {
+		return ""
+	}
+
+	return strings.TrimSpace(message[index+len(marker):])
+}
+
+// splitColumn splits a `table.column` reference, composite references are not split
+func splitColumn(reference string) (string, string) {
+	if strings.Contains(reference, ",") {
+		return "", ""
+	}
+
+	parts := strings.SplitN(reference, ".", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
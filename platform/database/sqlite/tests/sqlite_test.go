@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+)
+
+func TestSQLiteDialect(t *testing.T) {
+	cfg := database.Config{
+		Driver:   "sqlite3",
+		Database: filepath.Join(t.TempDir(), "test.db"),
+		Options:  map[string]string{"_foreign_keys": "1"},
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	migrations := []database.Migration{
+		{
+			Version:     1,
+			Description: "Create the users table",
+			Script:      `CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL UNIQUE, age INTEGER CONSTRAINT users_age_check CHECK (age >= 0))`,
+			DownScript:  `DROP TABLE users`,
+		},
+		{
+			Version:     2,
+			Description: "Create the posts table",
+			Script:      `CREATE TABLE posts (id INTEGER PRIMARY KEY, user_id INTEGER NOT NULL REFERENCES users (id))`,
+			DownScript:  `DROP TABLE posts`,
+		},
+	}
+
+	ctx := context.Background()
+
+	t.Run("it applies the migrations", func(t *testing.T) {
+		if err := database.MigrateWithOptions(db, migrations, database.MigrationOptions{}); err != nil {
+			t.Fatalf("could not run the migrations: %v", err)
+		}
+
+		infos, err := database.MigrationsStatus(db, migrations)
+		if err != nil {
+			t.Fatalf("could not get the migrations status: %v", err)
+		}
+
+		for _, info := range infos {
+			if info.Status != database.MigrationStatusApplied {
+				t.Fatalf("expected migration %v to be applied but got %s", info.Version, info.Status)
+			}
+		}
+	})
+
+	t.Run("it translates the constraint errors", func(t *testing.T) {
+		if _, err := db.ExecContext(ctx, `INSERT INTO users (id, email, age) VALUES (?, ?, ?)`, 1, "john@example.com", 42); err != nil {
+			t.Fatalf("could not insert the user: %v", err)
+		}
+
+		tcs := []struct {
+			name    string
+			query   string
+			args    []interface{}
+			matches func(err error) bool
+		}{
+			{
+				name:    "unique",
+				query:   `INSERT INTO users (id, email, age) VALUES (?, ?, ?)`,
+				args:    []interface{}{2, "john@example.com", 42},
+				matches: func(err error) bool { return database.IsUniqueConstraintError(err, "users.email") },
+			},
+			{
+				name:    "check",
+				query:   `INSERT INTO users (id, email, age) VALUES (?, ?, ?)`,
+				args:    []interface{}{3, "jane@example.com", -1},
+				matches: func(err error) bool { return database.IsCheckConstraintError(err, "users_age_check") },
+			},
+			{
+				name:  "not null",
+				query: `INSERT INTO users (id, email, age) VALUES (?, ?, ?)`,
+				args:  []interface{}{4, nil, 42},
+				matches: func(err error) bool {
+					e := database.Classify(fmt.Errorf("can't create user: %w", err))
+					return e != nil && e.Kind == database.ErrorKindNotNullViolation && e.Table == "users" && e.Column == "email"
+				},
+			},
+			{
+				name:    "foreign key",
+				query:   `INSERT INTO posts (id, user_id) VALUES (?, ?)`,
+				args:    []interface{}{1, 42},
+				matches: func(err error) bool { return database.IsForeignKeyConstraintError(err, "") },
+			},
+		}
+
+		for _, tc := range tcs {
+			t.Run(tc.name, func(t *testing.T) {
+				_, err := db.ExecContext(ctx, tc.query, tc.args...)
+				if err == nil {
+					t.Fatalf("expected the query to fail")
+				}
+
+				if !tc.matches(err) {
+					t.Fatalf("the error was not translated as expected: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("it rolls back to the target version", func(t *testing.T) {
+		if err := database.Rollback(db, migrations, 1, database.MigrationOptions{}); err != nil {
+			t.Fatalf("could not rollback the migrations: %v", err)
+		}
+
+		var exists bool
+		if err := db.GetContext(ctx, &exists, db.Dialect().TableExistsSQL(), "posts"); err != nil {
+			t.Fatalf("could not check the table existence: %v", err)
+		}
+
+		if exists {
+			t.Fatalf("expected the down script of the second migration to have dropped its table")
+		}
+	})
+}
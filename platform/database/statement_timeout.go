@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// statementTimeoutSetting is the Postgres setting aborting the statements running for longer than its value
+const statementTimeoutSetting = "statement_timeout"
+
+// StatementTimeoutMargin is subtracted from the time left before the deadline of a context so that the server gives up
+// on a statement before the client does
+var StatementTimeoutMargin = 50 * time.Millisecond
+
+// statementTimeouts are the statement timeouts of a database, see Config
+type statementTimeouts struct {
+	fallback time.Duration
+	max      time.Duration
+}
+
+func newStatementTimeouts(config Config) statementTimeouts {
+	return statementTimeouts{
+		fallback: time.Duration(config.StatementTimeout) * time.Millisecond,
+		max:      time.Duration(config.MaxStatementTimeout) * time.Millisecond,
+	}
+}
+
+// connection is the timeout of the statements run without a deadline, applied to the connections when they are opened.
+// It is 0 when the statements are not limited.
+func (timeouts statementTimeouts) connection() time.Duration {
+	if timeouts.fallback > 0 && (timeouts.max <= 0 || timeouts.fallback < timeouts.max) {
+		return timeouts.fallback
+	}
+
+	return timeouts.max
+}
+
+// forContext returns the timeout to apply to a statement run with the context, or 0 when the context has no deadline
+// or when its deadline is further than the connection timeout. A deadline too close to run a statement is reported
+// as a context.DeadlineExceeded error, which is classified as a timeout.
+func (timeouts statementTimeouts) forContext(ctx context.Context, dialect Dialect) (time.Duration, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok || dialect.SessionSettingSQL() == "" {
+		return 0, nil
+	}
+
+	remaining := time.Until(deadline) - StatementTimeoutMargin
+	if remaining < time.Millisecond {
+		return 0, fmt.Errorf("can't run the statement: %w", context.DeadlineExceeded)
+	}
+
+	if connection := timeouts.connection(); connection > 0 && remaining >= connection {
+		return 0, nil
+	}
+
+	return remaining, nil
+}
+
+func formatStatementTimeout(timeout time.Duration) string {
+	return strconv.FormatInt(timeout.Milliseconds(), 10)
+}
+
+// withStatementTimeout adds the statement timeout to the session settings of the context
+func withStatementTimeout(ctx context.Context, dialect Dialect, timeouts statementTimeouts) (SessionSettings, time.Duration, error) {
+	settings := SessionSettingsFromContext(ctx)
+
+	timeout, err := timeouts.forContext(ctx, dialect)
+	if err != nil || timeout == 0 {
+		return settings, 0, err
+	}
+
+	withTimeout := make(SessionSettings, len(settings)+1)
+	for name, value := range settings {
+		withTimeout[name] = value
+	}
+	withTimeout[statementTimeoutSetting] = formatStatementTimeout(timeout)
+
+	return withTimeout, timeout, nil
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestAuditTrail(t *testing.T) {
+	cfg := loadConfig(t)
+
+	sandbox, err := database.SandboxConnect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to the sandbox: %v", err)
+	}
+	defer sandbox.Close()
+
+	migrations := []database.Migration{
+		database.AuditLogMigration(1),
+		{
+			Version:     2,
+			Description: "Create the audited table",
+			Script:      `CREATE TABLE audited_accounts (id TEXT PRIMARY KEY, name TEXT NOT NULL)`,
+			DownScript:  `DROP TABLE audited_accounts`,
+		},
+		database.AuditTableMigration(3, "audited_accounts", ""),
+		{
+			Version:     4,
+			Description: "Create the audited table of another schema",
+			Script:      `CREATE SCHEMA audited; CREATE TABLE audited.accounts (id TEXT PRIMARY KEY)`,
+			DownScript:  `DROP SCHEMA audited CASCADE`,
+		},
+		database.AuditTableMigration(5, "audited.accounts", ""),
+	}
+
+	if err := database.MigrateWithOptions(sandbox, migrations, database.MigrationOptions{}); err != nil {
+		t.Fatalf("could not run the migrations: %v", err)
+	}
+
+	ctx := database.WithTraceID(database.WithUserID(context.Background(), "user-a"), "trace-a")
+
+	if _, err := sandbox.ExecContext(ctx, `INSERT INTO audited_accounts (id, name) VALUES ('account-a', 'first')`); err != nil {
+		t.Fatalf("could not insert the account: %v", err)
+	}
+
+	if _, err := sandbox.ExecContext(context.Background(), `UPDATE audited_accounts SET name = 'second' WHERE id = 'account-a'`); err != nil {
+		t.Fatalf("could not update the account: %v", err)
+	}
+
+	entries, err := database.AuditHistory(context.Background(), sandbox, "audited_accounts", "account-a")
+	if err != nil {
+		t.Fatalf("could not fetch the audit history: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries but got %d", len(entries))
+	}
+
+	t.Run("it records the actor and the trace ID of the context", func(t *testing.T) {
+		insert := entries[0]
+		if insert.Operation != "INSERT" || insert.Actor != "user-a" || insert.TraceID != "trace-a" {
+			t.Fatalf("unexpected insert entry: %+v", insert)
+		}
+
+		if string(insert.OldValues) != "null" {
+			t.Fatalf("expected no old values for an insert but got %s", insert.OldValues)
+		}
+	})
+
+	t.Run("it records the table qualified with its schema", func(t *testing.T) {
+		if _, err := sandbox.ExecContext(context.Background(), `INSERT INTO audited.accounts (id) VALUES ('account-a')`); err != nil {
+			t.Fatalf("could not insert the account: %v", err)
+		}
+
+		qualifiedEntries, err := database.AuditHistory(context.Background(), sandbox, "audited.accounts", "account-a")
+		if err != nil {
+			t.Fatalf("could not fetch the audit history: %v", err)
+		}
+
+		if len(qualifiedEntries) != 1 || qualifiedEntries[0].Table != "audited.accounts" {
+			t.Fatalf("expected 1 audit entry of audited.accounts but got %+v", qualifiedEntries)
+		}
+
+		if entries[0].Table != "public.audited_accounts" {
+			t.Fatalf("expected the table of the current schema to be qualified but got %s", entries[0].Table)
+		}
+	})
+
+	t.Run("it records the values before and after an update", func(t *testing.T) {
+		update := entries[1]
+		if update.Operation != "UPDATE" || update.Actor != "" || update.TraceID != "" {
+			t.Fatalf("unexpected update entry: %+v", update)
+		}
+
+		var oldValues, newValues map[string]string
+		if err := json.Unmarshal(update.OldValues, &oldValues); err != nil {
+			t.Fatalf("could not decode the old values: %v", err)
+		}
+
+		if err := json.Unmarshal(update.NewValues, &newValues); err != nil {
+			t.Fatalf("could not decode the new values: %v", err)
+		}
+
+		if oldValues["name"] != "first" || newValues["name"] != "second" {
+			t.Fatalf("expected the name to change from first to second but got %v and %v", oldValues, newValues)
+		}
+	})
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	var settings database.SessionSettings
+	handler := database.AuditMiddleware()(func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		settings = database.SessionSettingsFromContext(ctx)
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), web.KeyValues, &web.Values{TraceID: "trace-a"})
+	if err := handler(ctx, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), nil); err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+
+	if settings[database.AuditTraceIDSetting] != "trace-a" {
+		t.Fatalf("expected the trace ID to be added to the session settings but got %v", settings)
+	}
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+)
+
+type bulkItem struct {
+	ID       int    `db:"id"`
+	Code     string `db:"code"`
+	Ignored  string `db:"-"`
+	internal string
+}
+
+func TestBulkInsert(t *testing.T) {
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "bulk.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	testBulkInsert(t, db)
+}
+
+func TestSandboxBulkInsert(t *testing.T) {
+	db, err := database.SandboxConnect(loadConfig(t))
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	testBulkInsert(t, db)
+}
+
+func testBulkInsert(t *testing.T, db database.DB) {
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE bulk_items (id INTEGER PRIMARY KEY, code TEXT NOT NULL)`); err != nil {
+		t.Fatalf("could not create the table: %v", err)
+	}
+
+	count := func(t *testing.T) int {
+		var count int
+		if err := db.GetContext(ctx, &count, `SELECT COUNT(*) FROM bulk_items`); err != nil {
+			t.Fatalf("could not count the rows: %v", err)
+		}
+		return count
+	}
+
+	t.Run("it inserts a slice of structs", func(t *testing.T) {
+		items := []bulkItem{{ID: 1, Code: "a"}, {ID: 2, Code: "b"}, {ID: 3, Code: "c", Ignored: "ignored", internal: "internal"}}
+
+		inserted, err := db.BulkInsertContext(ctx, "bulk_items", items)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		if inserted != 3 || count(t) != 3 {
+			t.Fatalf("expected 3 rows to be inserted but got %d", inserted)
+		}
+	})
+
+	t.Run("it inserts rows given as values inside a transaction", func(t *testing.T) {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		inserted, err := tx.BulkInsertContext(ctx, "bulk_items", database.BulkRows{
+			Columns: []string{"code", "id"},
+			Values:  [][]interface{}{{"d", 4}, {"e", 5}},
+		})
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		if inserted != 2 {
+			t.Fatalf("expected 2 rows to be inserted but got %d", inserted)
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("could not commit the transaction: %v", err)
+		}
+
+		if count(t) != 5 {
+			t.Fatalf("expected 5 rows but got %d", count(t))
+		}
+	})
+
+	t.Run("it reports the offending row and inserts nothing", func(t *testing.T) {
+		items := []*bulkItem{{ID: 6, Code: "f"}, {ID: 7, Code: "g"}, {ID: 1, Code: "duplicate"}, {ID: 8, Code: "h"}}
+
+		_, err := db.BulkInsertContext(ctx, "bulk_items", items)
+
+		var bulkErr *database.BulkInsertError
+		if !errors.As(err, &bulkErr) || bulkErr.Row != 2 {
+			t.Fatalf("expected an error on row 2 but got: %v", err)
+		}
+
+		if e := database.Classify(err); e == nil || e.Kind != database.ErrorKindUniqueViolation {
+			t.Fatalf("expected the error to be classified as a unique violation but got: %#v", e)
+		}
+
+		if count(t) != 5 {
+			t.Fatalf("expected the rows to be rolled back but got %d rows", count(t))
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+)
+
+func TestCredentialsRotation(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+
+	if err := os.WriteFile(passwordFile, []byte("first-password\n"), 0600); err != nil {
+		t.Fatalf("could not write the password file: %v", err)
+	}
+
+	os.Setenv("CREDENTIALS_TEST_DATABASE", filepath.Join(dir, "credentials.db"))
+	defer os.Unsetenv("CREDENTIALS_TEST_DATABASE")
+
+	previousInterval := database.CredentialsCheckInterval
+	database.CredentialsCheckInterval = 0
+	defer func() { database.CredentialsCheckInterval = previousInterval }()
+
+	db, err := database.Connect(database.Config{
+		Driver:       "sqlite3",
+		Database:     "${CREDENTIALS_TEST_DATABASE}",
+		PasswordFile: passwordFile,
+	})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	// the cache size is a setting of the connection, it tells whether the same connection is reused
+	cacheSize := func() int {
+		var size int
+		if err := db.GetContext(ctx, &size, `PRAGMA cache_size`); err != nil {
+			t.Fatalf("could not read the cache size: %v", err)
+		}
+		return size
+	}
+
+	if _, err := db.ExecContext(ctx, `PRAGMA cache_size = 1234`); err != nil {
+		t.Fatalf("could not set the cache size: %v", err)
+	}
+
+	t.Run("it keeps the connections while the credentials do not change", func(t *testing.T) {
+		if size := cacheSize(); size != 1234 {
+			t.Fatalf("expected the connection to be reused but got a cache size of %d", size)
+		}
+	})
+
+	t.Run("it replaces the connections once the credentials are rotated", func(t *testing.T) {
+		if err := os.WriteFile(passwordFile, []byte("second-password\n"), 0600); err != nil {
+			t.Fatalf("could not rotate the password file: %v", err)
+		}
+
+		future := time.Now().Add(time.Minute)
+		if err := os.Chtimes(passwordFile, future, future); err != nil {
+			t.Fatalf("could not change the password file time: %v", err)
+		}
+
+		if size := cacheSize(); size == 1234 {
+			t.Fatalf("expected a new connection to be opened after the rotation")
+		}
+	})
+}
+
+func TestURLCredentialsFiles(t *testing.T) {
+	cfg := loadConfig(t)
+	passwordFile := filepath.Join(t.TempDir(), "password")
+
+	if err := os.WriteFile(passwordFile, []byte(cfg.Password+"\n"), 0600); err != nil {
+		t.Fatalf("could not write the password file: %v", err)
+	}
+
+	t.Run("it connects with the password of the file in the URL", func(t *testing.T) {
+		db, err := database.Connect(database.Config{
+			Driver:       cfg.Driver,
+			URL:          fmt.Sprintf("postgres://%s@%s:%d/%s?sslmode=disable", cfg.Username, cfg.Host, cfg.Port, cfg.Database),
+			PasswordFile: passwordFile,
+		})
+		if err != nil {
+			t.Fatalf("could not connect to DB: %v", err)
+		}
+		defer db.Close()
+	})
+
+	t.Run("it rejects an URL which can't hold the credentials", func(t *testing.T) {
+		_, err := database.Connect(database.Config{
+			Driver:       "sqlite3",
+			URL:          "file:" + filepath.Join(t.TempDir(), "credentials.db"),
+			PasswordFile: passwordFile,
+		})
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+}
@@ -3,9 +3,7 @@ package tests
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"os"
 	"reflect"
 	"testing"
 
@@ -27,20 +25,8 @@ func TestProdDatabase(t *testing.T) {
 			t.Fatalf("should not have panicked but got panic with %#v", err)
 		}
 	}()
-	cfgfile, err := os.Open("./testdata/databaseConfig.json")
-	if err != nil {
-		t.Fatalf("can't open databaseConfig file: %#v", err)
-	}
-
-	cfg := database.DefaultConfig
-
-	if err := json.NewDecoder(cfgfile).Decode(&cfg); err != nil {
-		t.Fatalf("can't parse file: %#v", err)
-	}
-
 	t.Run("ExecContext", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -131,8 +117,7 @@ func TestProdDatabase(t *testing.T) {
 	})
 
 	t.Run("NamedExecContext", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -221,8 +206,7 @@ func TestProdDatabase(t *testing.T) {
 	})
 
 	t.Run("GetContext previously inserted data", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -299,8 +283,7 @@ func TestProdDatabase(t *testing.T) {
 	})
 
 	t.Run("SelectContext previously inserted data", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -421,8 +404,7 @@ func TestProdDatabase(t *testing.T) {
 	})
 
 	t.Run("SelectMultipleContext previously inserted data", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -582,7 +564,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when everything works in the transaction it can be commited",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -594,7 +576,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when something fails in the transaction it cannot be commited",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						firstData,
@@ -606,7 +588,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when everything works in the transaction but it has been manually rollbacked it cannot be commited",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -619,7 +601,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when a transaction has already been commited it cannot be commited again",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -632,8 +614,7 @@ func TestProdDatabase(t *testing.T) {
 		}
 		doTest := func(tc testCase, t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
-				cleanup := migrate(cfg, t)
-				defer cleanup()
+				cfg := cloneDatabase(t, provider)
 				sqlxDB, err := connect(cfg)
 				if err != nil {
 					t.Fatalf("could not create sqlx connection: %#v", err)
@@ -713,7 +694,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when a transaction is rollbacked data is not saved",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -725,7 +706,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when something fails in the transaction it can be rollbacked",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						firstData,
@@ -737,7 +718,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when a transaction is already committed, rollbacking has no effect",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -750,7 +731,7 @@ func TestProdDatabase(t *testing.T) {
 			{
 				name: "when a transaction has already been rollbacked it cannot be rollbacked again",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -763,8 +744,7 @@ func TestProdDatabase(t *testing.T) {
 		}
 		doTest := func(tc testCase, t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
-				cleanup := migrate(cfg, t)
-				defer cleanup()
+				cfg := cloneDatabase(t, provider)
 				sqlxDB, err := connect(cfg)
 				if err != nil {
 					t.Fatalf("could not create sqlx connection: %#v", err)
@@ -833,8 +813,7 @@ func TestProdDatabase(t *testing.T) {
 	})
 
 	t.Run("Connect to a write and read database", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 
 		runInsertTest := func(db database.WriteDB, data testData) (err error) {
 			ctx := context.Background()
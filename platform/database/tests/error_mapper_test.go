@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/fewlinesco/go-pkg/platform/web"
+	"github.com/lib/pq"
+)
+
+func TestErrorMapper(t *testing.T) {
+	emailTakenMessage := web.NewErrorMessage("409001", "the email is already taken")
+
+	mapper := database.NewErrorMapper(database.ErrorMapping{
+		Kind:       database.ErrorKindUniqueViolation,
+		Constraint: "users_email_key",
+		HTTPCode:   http.StatusConflict,
+		Message:    emailTakenMessage,
+		Details:    web.ErrorDetails{"email": "is already taken"},
+	})
+
+	tcs := []struct {
+		name             string
+		err              error
+		expectedHTTPCode int
+		expectedMessage  web.ErrorMessage
+	}{
+		{
+			name:             "unique violation on a mapped constraint",
+			err:              fmt.Errorf("can't create user: %w", &pq.Error{Code: "23505", Constraint: "users_email_key"}),
+			expectedHTTPCode: http.StatusConflict,
+			expectedMessage:  emailTakenMessage,
+		},
+		{
+			name:             "unique violation on another constraint",
+			err:              &pq.Error{Code: "23505", Constraint: "users_pkey"},
+			expectedHTTPCode: http.StatusConflict,
+			expectedMessage:  database.ConflictMessage,
+		},
+		{
+			name:             "foreign key violation",
+			err:              &pq.Error{Code: "23503", Constraint: "posts_user_id_fkey"},
+			expectedHTTPCode: http.StatusUnprocessableEntity,
+			expectedMessage:  database.InvalidReferenceMessage,
+		},
+		{
+			name:             "statement timeout",
+			err:              &pq.Error{Code: "57014"},
+			expectedHTTPCode: http.StatusServiceUnavailable,
+			expectedMessage:  database.DatabaseUnavailableMessage,
+		},
+		{
+			name:             "unmapped database error",
+			err:              &pq.Error{Code: "42501"},
+			expectedHTTPCode: http.StatusInternalServerError,
+			expectedMessage:  web.UnmanagedErrorMessage,
+		},
+		{
+			name:             "web error",
+			err:              fmt.Errorf("%w", web.NewErrNotFoundResponse()),
+			expectedHTTPCode: http.StatusNotFound,
+			expectedMessage:  web.NotFoundMessage,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := mapper.Middleware()(func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+				return tc.err
+			})
+
+			err := handler(context.Background(), nil, nil, nil)
+			if !errors.Is(err, tc.err) && errors.Unwrap(err) == nil {
+				t.Fatalf("expected the middleware to keep the original error but got %v", err)
+			}
+
+			ctx := context.WithValue(context.Background(), web.KeyValues, &web.Values{TraceID: "traceid"})
+			recorder := httptest.NewRecorder()
+
+			if err := web.RespondError(ctx, recorder, err); err != nil {
+				t.Fatalf("could not respond: %v", err)
+			}
+
+			if recorder.Code != tc.expectedHTTPCode {
+				t.Fatalf("expected HTTP code %d but got %d", tc.expectedHTTPCode, recorder.Code)
+			}
+
+			var body web.Error
+			if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+				t.Fatalf("could not decode the response: %v", err)
+			}
+
+			if body.ErrorMessage != tc.expectedMessage {
+				t.Fatalf("expected message %#v but got %#v", tc.expectedMessage, body.ErrorMessage)
+			}
+		})
+	}
+
+	t.Run("it is used by RespondError once registered", func(t *testing.T) {
+		web.RegisterErrorTranslator(mapper.WebError)
+
+		ctx := context.WithValue(context.Background(), web.KeyValues, &web.Values{TraceID: "traceid"})
+		recorder := httptest.NewRecorder()
+
+		if err := web.RespondError(ctx, recorder, &pq.Error{Code: "23505", Constraint: "users_email_key"}); err != nil {
+			t.Fatalf("could not respond: %v", err)
+		}
+
+		if recorder.Code != http.StatusConflict {
+			t.Fatalf("expected HTTP code %d but got %d", http.StatusConflict, recorder.Code)
+		}
+	})
+}
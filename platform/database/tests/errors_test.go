@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/lib/pq"
+)
+
+func TestClassify(t *testing.T) {
+	tcs := []struct {
+		name              string
+		err               error
+		expectedKind      database.ErrorKind
+		expectedTable     string
+		expectedColumn    string
+		expectedRetryable bool
+	}{
+		{
+			name:          "unique violation",
+			err:           &pq.Error{Code: "23505", Table: "users", Constraint: "users_email_key"},
+			expectedKind:  database.ErrorKindUniqueViolation,
+			expectedTable: "users",
+		},
+		{
+			name:          "wrapped foreign key violation",
+			err:           fmt.Errorf("can't create post: %w", &pq.Error{Code: "23503", Table: "posts", Constraint: "posts_user_id_fkey"}),
+			expectedKind:  database.ErrorKindForeignKeyViolation,
+			expectedTable: "posts",
+		},
+		{
+			name:           "not null violation",
+			err:            &pq.Error{Code: "23502", Table: "users", Column: "email"},
+			expectedKind:   database.ErrorKindNotNullViolation,
+			expectedTable:  "users",
+			expectedColumn: "email",
+		},
+		{
+			name:              "serialization failure",
+			err:               fmt.Errorf("can't commit: %w", &pq.Error{Code: "40001"}),
+			expectedKind:      database.ErrorKindSerializationFailure,
+			expectedRetryable: true,
+		},
+		{
+			name:              "deadlock",
+			err:               &pq.Error{Code: "40P01"},
+			expectedKind:      database.ErrorKindDeadlock,
+			expectedRetryable: true,
+		},
+		{
+			name:         "statement timeout",
+			err:          &pq.Error{Code: "57014"},
+			expectedKind: database.ErrorKindTimeout,
+		},
+		{
+			name:         "context deadline",
+			err:          fmt.Errorf("can't select: %w", context.DeadlineExceeded),
+			expectedKind: database.ErrorKindTimeout,
+		},
+		{
+			name:         "server shutdown",
+			err:          &pq.Error{Code: "57P01"},
+			expectedKind: database.ErrorKindConnectionLost,
+		},
+		{
+			name:         "bad connection",
+			err:          fmt.Errorf("can't insert: %w", driver.ErrBadConn),
+			expectedKind: database.ErrorKindConnectionLost,
+		},
+		{
+			name:         "insufficient privilege",
+			err:          &pq.Error{Code: "42501"},
+			expectedKind: database.ErrorKindInsufficientPrivilege,
+		},
+		{
+			name:         "unknown engine error",
+			err:          &pq.Error{Code: "42P01"},
+			expectedKind: database.ErrorKindOther,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			e := database.Classify(tc.err)
+			if e == nil {
+				t.Fatalf("expected the error to be classified")
+			}
+
+			if e.Kind != tc.expectedKind {
+				t.Fatalf("expected kind %s but got %s", tc.expectedKind, e.Kind)
+			}
+
+			if e.Table != tc.expectedTable || e.Column != tc.expectedColumn {
+				t.Fatalf("expected %s.%s but got %s.%s", tc.expectedTable, tc.expectedColumn, e.Table, e.Column)
+			}
+
+			if e.Retryable != tc.expectedRetryable {
+				t.Fatalf("expected retryable to be %v but got %v", tc.expectedRetryable, e.Retryable)
+			}
+		})
+	}
+
+	t.Run("it does not classify other errors", func(t *testing.T) {
+		for _, err := range []error{nil, sql.ErrNoRows, context.Canceled, fmt.Errorf("some error")} {
+			if e := database.Classify(err); e != nil {
+				t.Fatalf("expected %v not to be classified but got %s", err, e.Kind)
+			}
+		}
+	})
+
+	t.Run("the helpers match wrapped errors", func(t *testing.T) {
+		err := fmt.Errorf("can't create user: %w", &pq.Error{Code: "23505", Constraint: "users_email_key"})
+
+		if !database.IsUniqueConstraintError(err, "users_email_key") {
+			t.Fatalf("expected the wrapped error to be a unique constraint error")
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestFilterSpec(t *testing.T) {
+	spec := database.FilterSpec{
+		Filters: []database.Filter{
+			{Param: "status", Column: "status", Operator: database.FilterOperatorIn, Type: database.FilterTypeString, AllowedValues: []string{"active", "archived"}},
+			{Param: "created_after", Column: "created_at", Operator: database.FilterOperatorGreaterThan, Type: database.FilterTypeTime},
+			{Param: "min_age", Column: "age", Operator: database.FilterOperatorGreaterThanOrEqual, Type: database.FilterTypeInteger},
+		},
+		Sorts:       map[string]string{"created_at": "created_at", "id": "id"},
+		DefaultSort: "id",
+	}
+
+	tcs := []struct {
+		name            string
+		params          map[string]string
+		expectedWhere   string
+		expectedArgs    []interface{}
+		expectedOrderBy string
+		expectedDetails web.ErrorDetails
+	}{
+		{
+			name:            "when no parameter is given it uses the default sort",
+			params:          map[string]string{"cursor": "ignored"},
+			expectedWhere:   "",
+			expectedOrderBy: "id ASC",
+		},
+		{
+			name:            "when filters and a sort are given",
+			params:          map[string]string{"status": "active,archived", "created_after": "2021-01-02", "sort": "-created_at,id"},
+			expectedWhere:   "status IN (?, ?) AND created_at > ?",
+			expectedArgs:    []interface{}{"active", "archived", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+			expectedOrderBy: "created_at DESC, id ASC",
+		},
+		{
+			name:   "when the values are invalid it names every offending parameter",
+			params: map[string]string{"status": "deleted", "min_age": "old", "sort": "name"},
+			expectedDetails: web.ErrorDetails{
+				"status":  "must be one of active, archived",
+				"min_age": "must be an integer",
+				"sort":    `can't sort by "name", expected one of created_at, id`,
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			expression, err := spec.Parse(tc.params)
+
+			if tc.expectedDetails != nil {
+				var webErr *web.Error
+				if !errors.As(err, &webErr) {
+					t.Fatalf("expected a web error but got %v", err)
+				}
+
+				if !reflect.DeepEqual(webErr.Details, tc.expectedDetails) {
+					t.Fatalf("expected details %#v but got %#v", tc.expectedDetails, webErr.Details)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			where, args := expression.Where()
+			if where != tc.expectedWhere || !reflect.DeepEqual(args, tc.expectedArgs) {
+				t.Fatalf("expected %q %#v but got %q %#v", tc.expectedWhere, tc.expectedArgs, where, args)
+			}
+
+			if orderBy := expression.OrderBy(); orderBy != tc.expectedOrderBy {
+				t.Fatalf("expected %q but got %q", tc.expectedOrderBy, orderBy)
+			}
+		})
+	}
+}
@@ -1,52 +1,81 @@
 package tests
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"os"
 	"testing"
 
-	"github.com/GuiaBolso/darwin"
 	"github.com/fewlinesco/go-pkg/platform/database"
 	"github.com/jmoiron/sqlx"
 )
 
-func migrate(cfg database.Config, t *testing.T) func() {
-	db, err := database.Connect(cfg)
+var (
+	// provider clones a database with the test_data table for each test needing committed data
+	provider *database.SandboxProvider
+	// emptyProvider clones an empty database for each test of the migrations
+	emptyProvider *database.SandboxProvider
+)
+
+var testDataMigrations = []database.Migration{
+	{
+		Version:     1,
+		Description: "Create test data table",
+		Script: `
+			CREATE TABLE test_data(
+				id UUID PRIMARY KEY,
+				code VARCHAR(63),
+				number INTEGER DEFAULT NULL
+			)`,
+	},
+}
+
+func readConfig() (database.Config, error) {
+	cfgfile, err := os.Open("./testdata/databaseConfig.json")
 	if err != nil {
-		t.Fatalf("could not connect to DB: %#v, with config: %#v", err, cfg)
+		return database.Config{}, fmt.Errorf("can't open databaseConfig file: %v", err)
 	}
-	defer db.Close()
-
-	err = database.Migrate(db, []darwin.Migration{
-		{
-			Version:     1,
-			Description: "Create test data table",
-			Script: `
-				DROP TABLE IF EXISTS test_data;
-				CREATE TABLE test_data(
-					id UUID PRIMARY KEY,
-					code VARCHAR(63),
-					number INTEGER DEFAULT NULL
-				)`,
-		},
-	})
+	defer cfgfile.Close()
+
+	cfg := database.DefaultConfig
+
+	if err := json.NewDecoder(cfgfile).Decode(&cfg); err != nil {
+		return database.Config{}, fmt.Errorf("can't parse file: %v", err)
+	}
+
+	return cfg, nil
+}
 
+func loadConfig(t *testing.T) database.Config {
+	cfg, err := readConfig()
 	if err != nil {
-		t.Fatalf("could not migrate the database: %#v", err)
+		t.Fatalf("%v", err)
 	}
 
-	return func() {
-		db, err := database.Connect(cfg)
-		if err != nil {
-			t.Fatalf("could not connect to DB: %#v", err)
-		}
-		defer db.Close()
+	return cfg
+}
+
+// cloneDatabase returns the configuration of a database of its own for the test, dropped once the test is over
+func cloneDatabase(t *testing.T, provider *database.SandboxProvider) database.Config {
+	cfg, drop, err := provider.Clone()
+	if err != nil {
+		t.Fatalf("could not clone the database: %v", err)
+	}
 
-		_, err = db.ExecContext(context.Background(), `DROP TABLE IF EXISTS test_data; DROP TABLE IF EXISTS darwin_migrations;`)
-		if err != nil {
-			t.Fatalf("could not clean the database: %#v", err)
+	t.Cleanup(func() {
+		if err := drop(); err != nil {
+			t.Errorf("could not drop the database: %v", err)
 		}
+	})
+
+	return cfg
+}
+
+// migrate creates the test_data table inside the sandbox, its schema and data being rolled back when it is closed
+func migrate(t *testing.T, sandbox database.WriteDB) {
+	if err := database.MigrateWithOptions(sandbox, testDataMigrations, database.MigrationOptions{}); err != nil {
+		t.Fatalf("could not migrate the sandbox: %v", err)
 	}
 }
 
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "idempotency.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	if err := database.MigrateWithOptions(db, []database.Migration{database.IdempotencyKeysMigration(1)}, database.MigrationOptions{}); err != nil {
+		t.Fatalf("could not apply the migration: %v", err)
+	}
+
+	ctx := context.Background()
+	store := database.NewIdempotencyStore(db, time.Hour, time.Minute)
+
+	t.Run("it reserves an unknown key", func(t *testing.T) {
+		record, err := store.Reserve(ctx, "create-order-1", "fingerprint")
+		if err != nil || record != nil {
+			t.Fatalf("expected the key to be reserved but got %#v: %v", record, err)
+		}
+
+		record, err = store.Reserve(ctx, "create-order-1", "fingerprint")
+		if err != nil || record == nil || record.Response != nil || record.Fingerprint != "fingerprint" {
+			t.Fatalf("expected the key to be in flight but got %#v: %v", record, err)
+		}
+	})
+
+	t.Run("it returns the saved response", func(t *testing.T) {
+		response := web.IdempotentResponse{
+			StatusCode: http.StatusCreated,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       []byte(`{"id":1}`),
+		}
+
+		if err := store.Save(ctx, "create-order-1", response); err != nil {
+			t.Fatalf("could not save the response: %v", err)
+		}
+
+		if err := store.Release(ctx, "create-order-1"); err != nil {
+			t.Fatalf("could not release the key: %v", err)
+		}
+
+		record, err := store.Reserve(ctx, "create-order-1", "fingerprint")
+		if err != nil || record == nil || record.Response == nil {
+			t.Fatalf("expected the saved response but got %#v: %v", record, err)
+		}
+
+		if record.Response.StatusCode != http.StatusCreated || string(record.Response.Body) != `{"id":1}` || record.Response.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("expected the saved response but got %#v", record.Response)
+		}
+	})
+
+	t.Run("it forgets a released key", func(t *testing.T) {
+		if record, err := store.Reserve(ctx, "create-order-2", "fingerprint"); err != nil || record != nil {
+			t.Fatalf("expected the key to be reserved but got %#v: %v", record, err)
+		}
+
+		if err := store.Release(ctx, "create-order-2"); err != nil {
+			t.Fatalf("could not release the key: %v", err)
+		}
+
+		if record, err := store.Reserve(ctx, "create-order-2", "other fingerprint"); err != nil || record != nil {
+			t.Fatalf("expected the key to be reserved again but got %#v: %v", record, err)
+		}
+	})
+
+	t.Run("it replaces the expired keys", func(t *testing.T) {
+		expiring := database.NewIdempotencyStore(db, time.Nanosecond, time.Minute)
+		time.Sleep(time.Millisecond)
+
+		if record, err := expiring.Reserve(ctx, "create-order-1", "other fingerprint"); err != nil || record != nil {
+			t.Fatalf("expected the expired key to be reserved again but got %#v: %v", record, err)
+		}
+	})
+
+	t.Run("it replaces the keys in flight whose lease expired", func(t *testing.T) {
+		for _, key := range []string{"create-order-3", "create-order-4"} {
+			if record, err := store.Reserve(ctx, key, "fingerprint"); err != nil || record != nil {
+				t.Fatalf("expected the key to be reserved but got %#v: %v", record, err)
+			}
+		}
+
+		if err := store.Save(ctx, "create-order-4", web.IdempotentResponse{StatusCode: http.StatusCreated}); err != nil {
+			t.Fatalf("could not save the response: %v", err)
+		}
+
+		leasing := database.NewIdempotencyStore(db, time.Hour, time.Nanosecond)
+		time.Sleep(time.Millisecond)
+
+		if record, err := leasing.Reserve(ctx, "create-order-4", "fingerprint"); err != nil || record == nil || record.Response == nil {
+			t.Fatalf("expected the saved response to be kept but got %#v: %v", record, err)
+		}
+
+		if record, err := leasing.Reserve(ctx, "create-order-3", "other fingerprint"); err != nil || record != nil {
+			t.Fatalf("expected the key to be reserved again but got %#v: %v", record, err)
+		}
+	})
+}
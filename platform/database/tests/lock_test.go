@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestLockKey(t *testing.T) {
+	if database.LockKey("cache-refresh") != database.LockKey("cache-refresh") {
+		t.Fatalf("expected the same name to give the same key")
+	}
+
+	if database.LockKey("account:1") == database.LockKey("account:2") {
+		t.Fatalf("expected different names to give different keys")
+	}
+}
+
+func TestLockUnsupportedDialect(t *testing.T) {
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "lock.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := database.TryAcquireLock(context.Background(), db, "cache-refresh", 0); err == nil {
+		t.Fatalf("expected an error as SQLite does not support advisory locks")
+	}
+}
+
+func TestSessionLocks(t *testing.T) {
+	cfg := loadConfig(t)
+	ctx := context.Background()
+
+	first, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer first.Close()
+
+	second, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer second.Close()
+
+	lock, err := database.AcquireLock(ctx, first, "cache-refresh")
+	if err != nil {
+		t.Fatalf("could not acquire the lock: %v", err)
+	}
+
+	t.Run("it can't be acquired by another session", func(t *testing.T) {
+		_, err := database.TryAcquireLock(ctx, second, "cache-refresh", 300*time.Millisecond)
+		if !errors.Is(err, database.ErrLockNotAcquired) {
+			t.Fatalf("expected ErrLockNotAcquired but got: %v", err)
+		}
+	})
+
+	t.Run("it can be acquired once released", func(t *testing.T) {
+		if err := lock.Release(ctx); err != nil {
+			t.Fatalf("could not release the lock: %v", err)
+		}
+
+		if err := lock.Release(ctx); !errors.Is(err, database.ErrLockReleased) {
+			t.Fatalf("expected ErrLockReleased but got: %v", err)
+		}
+
+		other, err := database.TryAcquireLock(ctx, second, "cache-refresh", 0)
+		if err != nil {
+			t.Fatalf("could not acquire the released lock: %v", err)
+		}
+		defer other.Release(ctx)
+
+		select {
+		case <-other.Lost():
+			t.Fatalf("expected the lock not to be lost")
+		default:
+		}
+	})
+}
+
+func TestReleaseLockWithCancelledContext(t *testing.T) {
+	cfg := loadConfig(t)
+
+	first, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer first.Close()
+
+	second, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer second.Close()
+
+	lock, err := database.AcquireLock(context.Background(), first, "cancelled-release")
+	if err != nil {
+		t.Fatalf("could not acquire the lock: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := lock.Release(ctx); err == nil {
+		t.Fatalf("expected the unlock to fail with the cancelled context")
+	}
+
+	other, err := database.TryAcquireLock(context.Background(), second, "cancelled-release", 2*time.Second)
+	if err != nil {
+		t.Fatalf("expected the lock to be released with its connection but got: %v", err)
+	}
+	defer other.Release(context.Background())
+
+	var held bool
+	if err := first.GetContext(context.Background(), &held, `SELECT pg_try_advisory_lock($1)`, database.LockKey("cancelled-release")); err != nil {
+		t.Fatalf("could not try the lock from the pool: %v", err)
+	}
+
+	if held {
+		t.Fatalf("expected no pooled connection to hold the lock")
+	}
+}
+
+func TestLostSessionLock(t *testing.T) {
+	cfg := loadConfig(t)
+	ctx := context.Background()
+
+	checkInterval := database.LockCheckInterval
+	database.LockCheckInterval = 50 * time.Millisecond
+	defer func() { database.LockCheckInterval = checkInterval }()
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	lock, err := database.AcquireLock(ctx, db, "leader")
+	if err != nil {
+		t.Fatalf("could not acquire the lock: %v", err)
+	}
+	defer lock.Release(ctx)
+
+	healthCheck := lock.HealthCheck()
+	if status := healthCheck(ctx); status.State != web.HealthzStateHealthy {
+		t.Fatalf("expected the held lock to be healthy but got %#v", status)
+	}
+
+	var pid int
+	if err := db.GetContext(ctx, &pid, `
+		SELECT pid FROM pg_locks
+		WHERE locktype = 'advisory' AND granted AND objsubid = 1
+			AND classid = (($1::bigint >> 32) & 4294967295)::oid AND objid = ($1::bigint & 4294967295)::oid`,
+		database.LockKey("leader")); err != nil {
+		t.Fatalf("could not find the session holding the lock: %v", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `SELECT pg_terminate_backend($1)`, pid); err != nil {
+		t.Fatalf("could not terminate the session holding the lock: %v", err)
+	}
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the lock to be lost with its session")
+	}
+
+	if err := lock.Err(); !errors.Is(err, database.ErrLockLost) {
+		t.Fatalf("expected ErrLockLost but got: %v", err)
+	}
+
+	if status := healthCheck(ctx); status.State != web.HealthzStateUnhealthy || status.Error == "" {
+		t.Fatalf("expected the lost lock to be unhealthy but got %#v", status)
+	}
+}
+
+func TestTransactionLocks(t *testing.T) {
+	cfg := loadConfig(t)
+	ctx := context.Background()
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	first, err := db.Begin()
+	if err != nil {
+		t.Fatalf("could not begin the transaction: %v", err)
+	}
+	defer first.Rollback()
+
+	if err := database.LockTx(ctx, first, "account:1"); err != nil {
+		t.Fatalf("could not acquire the lock: %v", err)
+	}
+
+	second, err := db.Begin()
+	if err != nil {
+		t.Fatalf("could not begin the transaction: %v", err)
+	}
+	defer second.Rollback()
+
+	if err := database.TryLockTx(ctx, second, "account:1"); !errors.Is(err, database.ErrLockNotAcquired) {
+		t.Fatalf("expected ErrLockNotAcquired but got: %v", err)
+	}
+
+	if err := first.Commit(); err != nil {
+		t.Fatalf("could not commit the transaction: %v", err)
+	}
+
+	if err := database.TryLockTx(ctx, second, "account:1"); err != nil {
+		t.Fatalf("expected the lock to be released with the transaction but got: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+)
+
+func TestMain(m *testing.M) {
+	cfg, err := readConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	provider = database.NewSandboxProvider(cfg, testDataMigrations, database.MigrationOptions{})
+	emptyProvider = database.NewSandboxProvider(cfg, nil, database.MigrationOptions{})
+
+	code := m.Run()
+
+	for _, p := range []*database.SandboxProvider{provider, emptyProvider} {
+		if err := p.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+
+	os.Exit(code)
+}
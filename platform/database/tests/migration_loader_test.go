@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	type testCase struct {
+		name               string
+		files              fstest.MapFS
+		expectedMigrations []database.Migration
+		expectedError      string
+	}
+
+	tcs := []testCase{
+		{
+			name: "it loads the up and down scripts ordered by version",
+			files: fstest.MapFS{
+				"migrations/0002_add_users_email.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN email TEXT;")},
+				"migrations/0001_create_users.up.sql":      {Data: []byte("CREATE TABLE users (id UUID PRIMARY KEY);")},
+				"migrations/0001_create_users.down.sql":    {Data: []byte("DROP TABLE users;")},
+				"migrations/0002_add_users_email.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN email;")},
+				"migrations/README.md":                     {Data: []byte("not a migration")},
+			},
+			expectedMigrations: []database.Migration{
+				{
+					Version:     1,
+					Description: "create users",
+					Script:      "CREATE TABLE users (id UUID PRIMARY KEY);",
+					DownScript:  "DROP TABLE users;",
+				},
+				{
+					Version:     2,
+					Description: "add users email",
+					Script:      "ALTER TABLE users ADD COLUMN email TEXT;",
+					DownScript:  "ALTER TABLE users DROP COLUMN email;",
+				},
+			},
+		},
+		{
+			name: "it loads migrations without down scripts",
+			files: fstest.MapFS{
+				"migrations/1_create_users.up.sql": {Data: []byte("CREATE TABLE users (id UUID PRIMARY KEY);")},
+			},
+			expectedMigrations: []database.Migration{
+				{
+					Version:     1,
+					Description: "create users",
+					Script:      "CREATE TABLE users (id UUID PRIMARY KEY);",
+				},
+			},
+		},
+		{
+			name: "it rejects duplicate versions",
+			files: fstest.MapFS{
+				"migrations/0001_create_users.up.sql":  {Data: []byte("CREATE TABLE users (id UUID PRIMARY KEY);")},
+				"migrations/0001_create_groups.up.sql": {Data: []byte("CREATE TABLE groups (id UUID PRIMARY KEY);")},
+			},
+			expectedError: "duplicate migration version 1",
+		},
+		{
+			name: "it rejects gaps between versions",
+			files: fstest.MapFS{
+				"migrations/0001_create_users.up.sql":  {Data: []byte("CREATE TABLE users (id UUID PRIMARY KEY);")},
+				"migrations/0003_create_groups.up.sql": {Data: []byte("CREATE TABLE groups (id UUID PRIMARY KEY);")},
+			},
+			expectedError: "gap in the migration versions",
+		},
+		{
+			name: "it rejects down scripts without up scripts",
+			files: fstest.MapFS{
+				"migrations/0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+			},
+			expectedError: "no up script",
+		},
+		{
+			name: "it rejects SQL files which do not follow the naming convention",
+			files: fstest.MapFS{
+				"migrations/create_users.sql": {Data: []byte("CREATE TABLE users (id UUID PRIMARY KEY);")},
+			},
+			expectedError: "invalid migration file name create_users.sql",
+		},
+	}
+
+	for _, tc := range tcs {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			migrations, err := database.LoadMigrations(tc.files, "migrations")
+
+			if tc.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+					t.Fatalf("expected an error containing %q but got: %v", tc.expectedError, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("could not load the migrations: %v", err)
+			}
+
+			if !reflect.DeepEqual(migrations, tc.expectedMigrations) {
+				t.Fatalf("expected migrations %#v but got %#v", tc.expectedMigrations, migrations)
+			}
+		})
+	}
+}
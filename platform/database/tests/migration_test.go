@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/fewlinesco/go-pkg/platform/logging"
+)
+
+func TestReversibleMigrations(t *testing.T) {
+	cfg := cloneDatabase(t, emptyProvider)
+
+	migrations := []database.Migration{
+		{
+			Version:     1,
+			Description: "Create the first table",
+			Script:      `CREATE TABLE reversible_first (id INTEGER PRIMARY KEY)`,
+			DownScript:  `DROP TABLE reversible_first`,
+		},
+		{
+			Version:     2,
+			Description: "Create the second table",
+			Script:      `CREATE TABLE reversible_second (id INTEGER PRIMARY KEY)`,
+			DownScript:  `DROP TABLE reversible_second`,
+		},
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	assertStatuses := func(t *testing.T, migrations []database.Migration, expected ...database.MigrationStatus) {
+		infos, err := database.MigrationsStatus(db, migrations)
+		if err != nil {
+			t.Fatalf("could not get the migrations status: %v", err)
+		}
+
+		if len(infos) != len(expected) {
+			t.Fatalf("expected %d migrations but got %#v", len(expected), infos)
+		}
+
+		for i, info := range infos {
+			if info.Status != expected[i] {
+				t.Fatalf("expected migration %v to be %s but got %s", info.Version, expected[i], info.Status)
+			}
+		}
+	}
+
+	t.Run("it prints the pending migrations without applying them on dry run", func(t *testing.T) {
+		var output bytes.Buffer
+		if err := database.RunMigrationCommand(db, migrations, []string{"--dry-run"}, database.MigrationOptions{Output: &output}); err != nil {
+			t.Fatalf("could not dry run the migrations: %v", err)
+		}
+
+		for _, migration := range migrations {
+			if !strings.Contains(output.String(), migration.Script) {
+				t.Fatalf("expected the dry run output to contain %q but got %q", migration.Script, output.String())
+			}
+		}
+
+		assertStatuses(t, migrations, database.MigrationStatusPending, database.MigrationStatusPending)
+	})
+
+	t.Run("it applies the migrations", func(t *testing.T) {
+		if err := database.RunMigrationCommand(db, migrations, []string{"up"}, database.MigrationOptions{Output: &bytes.Buffer{}}); err != nil {
+			t.Fatalf("could not run the migrations: %v", err)
+		}
+
+		assertStatuses(t, migrations, database.MigrationStatusApplied, database.MigrationStatusApplied)
+	})
+
+	t.Run("it reports modified and unknown migrations", func(t *testing.T) {
+		modified := []database.Migration{migrations[0]}
+		modified[0].Script = `CREATE TABLE reversible_first (id BIGINT PRIMARY KEY)`
+
+		assertStatuses(t, modified, database.MigrationStatusChecksumMismatch, database.MigrationStatusMissing)
+
+		var output bytes.Buffer
+		if err := database.RunMigrationCommand(db, modified, []string{"status"}, database.MigrationOptions{Output: &output}); err != nil {
+			t.Fatalf("could not print the migrations status: %v", err)
+		}
+
+		if !strings.Contains(output.String(), string(database.MigrationStatusChecksumMismatch)) {
+			t.Fatalf("expected the status output to report the checksum mismatch but got %q", output.String())
+		}
+	})
+
+	t.Run("it prints the down scripts without running them on dry run", func(t *testing.T) {
+		var output bytes.Buffer
+		if err := database.RunMigrationCommand(db, migrations, []string{"rollback", "0", "--dry-run"}, database.MigrationOptions{Output: &output}); err != nil {
+			t.Fatalf("could not dry run the rollback: %v", err)
+		}
+
+		if strings.Index(output.String(), migrations[1].DownScript) > strings.Index(output.String(), migrations[0].DownScript) {
+			t.Fatalf("expected the most recent migration to be rolled back first but got %q", output.String())
+		}
+
+		assertStatuses(t, migrations, database.MigrationStatusApplied, database.MigrationStatusApplied)
+	})
+
+	t.Run("it refuses to rollback a migration without down script", func(t *testing.T) {
+		withoutDownScript := []database.Migration{migrations[0], migrations[1]}
+		withoutDownScript[1].DownScript = ""
+
+		if err := database.Rollback(db, withoutDownScript, 0, database.MigrationOptions{}); err == nil {
+			t.Fatalf("expected an error when a migration has no down script")
+		}
+
+		assertStatuses(t, migrations, database.MigrationStatusApplied, database.MigrationStatusApplied)
+	})
+
+	t.Run("it rolls back to the target version", func(t *testing.T) {
+		if err := database.RunMigrationCommand(db, migrations, []string{"rollback", "1"}, database.MigrationOptions{Output: &bytes.Buffer{}}); err != nil {
+			t.Fatalf("could not rollback the migrations: %v", err)
+		}
+
+		assertStatuses(t, migrations, database.MigrationStatusApplied, database.MigrationStatusPending)
+
+		var exists bool
+		if err := db.GetContext(context.Background(), &exists, `SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'reversible_second')`); err != nil {
+			t.Fatalf("could not check the table existence: %v", err)
+		}
+
+		if exists {
+			t.Fatalf("expected the down script of the second migration to have dropped its table")
+		}
+	})
+}
+
+func TestConcurrentMigrations(t *testing.T) {
+	cfg := cloneDatabase(t, emptyProvider)
+
+	migrations := []database.Migration{
+		{
+			Version:     1,
+			Description: "Create the concurrent table",
+			Script:      `CREATE TABLE concurrent_migration (id INTEGER PRIMARY KEY); SELECT pg_sleep(1);`,
+		},
+	}
+
+	const instances = 3
+	errs := make(chan error, instances)
+
+	for i := 0; i < instances; i++ {
+		go func() {
+			db, err := database.Connect(cfg)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer db.Close()
+
+			errs <- database.MigrateWithOptions(db, migrations, database.MigrationOptions{
+				LockTimeout: 10 * time.Second,
+				Logger:      logging.NewTestLogger(t),
+			})
+		}()
+	}
+
+	for i := 0; i < instances; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("every instance should have migrated successfully but got: %v", err)
+		}
+	}
+}
+
+func TestSandboxMigrations(t *testing.T) {
+	cfg := loadConfig(t)
+
+	migrations := []database.Migration{
+		{
+			Version:     1,
+			Description: "Create the sandboxed table",
+			Script:      `CREATE TABLE sandboxed_migration (id INTEGER PRIMARY KEY)`,
+			DownScript:  `DROP TABLE sandboxed_migration`,
+		},
+		{
+			Version:     2,
+			Description: "Add a column to the sandboxed table",
+			Script:      `ALTER TABLE sandboxed_migration ADD COLUMN code TEXT`,
+			DownScript:  `ALTER TABLE sandboxed_migration DROP COLUMN code`,
+		},
+	}
+
+	tableExists := func(t *testing.T, db database.DB, table string) bool {
+		var exists bool
+		if err := db.GetContext(context.Background(), &exists, db.Dialect().TableExistsSQL(), table); err != nil {
+			t.Fatalf("could not check the table existence: %v", err)
+		}
+
+		return exists
+	}
+
+	sandbox, err := database.SandboxConnect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to the sandbox: %v", err)
+	}
+
+	t.Run("it migrates inside the sandbox", func(t *testing.T) {
+		if err := database.MigrateWithOptions(sandbox, migrations, database.MigrationOptions{}); err != nil {
+			t.Fatalf("could not run the migrations: %v", err)
+		}
+
+		if _, err := sandbox.ExecContext(context.Background(), `INSERT INTO sandboxed_migration (id, code) VALUES (1, 'code')`); err != nil {
+			t.Fatalf("could not use the migrated table: %v", err)
+		}
+
+		infos, err := database.MigrationsStatus(sandbox, migrations)
+		if err != nil {
+			t.Fatalf("could not get the migrations status: %v", err)
+		}
+
+		for _, info := range infos {
+			if info.Status != database.MigrationStatusApplied {
+				t.Fatalf("expected migration %v to be applied but got %s", info.Version, info.Status)
+			}
+		}
+	})
+
+	t.Run("it rolls back inside the sandbox", func(t *testing.T) {
+		if err := database.Rollback(sandbox, migrations, 0, database.MigrationOptions{}); err != nil {
+			t.Fatalf("could not rollback the migrations: %v", err)
+		}
+
+		if tableExists(t, sandbox, "sandboxed_migration") {
+			t.Fatalf("expected the down scripts to have dropped the table")
+		}
+	})
+
+	t.Run("the schema vanishes when the sandbox is closed", func(t *testing.T) {
+		if err := database.MigrateWithOptions(sandbox, migrations, database.MigrationOptions{}); err != nil {
+			t.Fatalf("could not run the migrations: %v", err)
+		}
+
+		if err := sandbox.Close(); err != nil {
+			t.Fatalf("could not close the sandbox: %v", err)
+		}
+
+		db, err := database.Connect(cfg)
+		if err != nil {
+			t.Fatalf("could not connect to DB: %v", err)
+		}
+		defer db.Close()
+
+		if tableExists(t, db, "sandboxed_migration") || tableExists(t, db, "darwin_migrations") {
+			t.Fatalf("expected the migrations to be rolled back with the sandbox")
+		}
+	})
+}
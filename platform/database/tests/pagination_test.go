@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestPaginator(t *testing.T) {
+	type item struct {
+		ID       int    `db:"id"`
+		Category string `db:"category"`
+	}
+
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "pagination.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(context.Background(), `CREATE TABLE items (id INTEGER PRIMARY KEY, category TEXT NOT NULL)`); err != nil {
+		t.Fatalf("could not create the table: %v", err)
+	}
+
+	for i := 1; i <= 7; i++ {
+		category := "a"
+		if i%2 == 0 {
+			category = "b"
+		}
+
+		if _, err := db.ExecContext(context.Background(), `INSERT INTO items (id, category) VALUES (?, ?)`, i, category); err != nil {
+			t.Fatalf("could not insert item: %v", err)
+		}
+	}
+
+	paginator := database.NewPaginator([]byte("secret"))
+
+	// category ascending then id descending: 7, 5, 3, 1, 6, 4, 2
+	query := database.PageQuery{
+		Query:    `SELECT id, category FROM items WHERE id > ?`,
+		Args:     []interface{}{0},
+		SortKeys: []database.SortKey{{Column: "category"}, {Column: "id", Descending: true}},
+		Limit:    3,
+	}
+
+	ids := func(items []item) string {
+		return fmt.Sprintf("%v", func() []int {
+			var ids []int
+			for _, i := range items {
+				ids = append(ids, i.ID)
+			}
+			return ids
+		}())
+	}
+
+	selectPage := func(t *testing.T, cursor string) ([]item, database.Page) {
+		var items []item
+
+		q := query
+		q.Cursor = cursor
+
+		page, err := paginator.SelectPage(context.Background(), db, &items, q)
+		if err != nil {
+			t.Fatalf("could not select the page: %v", err)
+		}
+
+		return items, page
+	}
+
+	t.Run("it walks the pages forward and backward", func(t *testing.T) {
+		first, firstPage := selectPage(t, "")
+		if ids(first) != "[7 5 3]" || firstPage.Previous != "" || firstPage.Next == "" {
+			t.Fatalf("unexpected first page %s %#v", ids(first), firstPage)
+		}
+
+		second, secondPage := selectPage(t, firstPage.Next)
+		if ids(second) != "[1 6 4]" || secondPage.Previous == "" || secondPage.Next == "" {
+			t.Fatalf("unexpected second page %s %#v", ids(second), secondPage)
+		}
+
+		last, lastPage := selectPage(t, secondPage.Next)
+		if ids(last) != "[2]" || lastPage.Next != "" || lastPage.Previous == "" {
+			t.Fatalf("unexpected last page %s %#v", ids(last), lastPage)
+		}
+
+		back, backPage := selectPage(t, lastPage.Previous)
+		if ids(back) != "[1 6 4]" || backPage.Previous == "" || backPage.Next == "" {
+			t.Fatalf("unexpected page when going backward %s %#v", ids(back), backPage)
+		}
+
+		start, startPage := selectPage(t, backPage.Previous)
+		if ids(start) != "[7 5 3]" || startPage.Previous != "" {
+			t.Fatalf("unexpected first page when going backward %s %#v", ids(start), startPage)
+		}
+	})
+
+	t.Run("it refuses forged cursors", func(t *testing.T) {
+		_, page := selectPage(t, "")
+
+		var items []item
+
+		forged := query
+		forged.Cursor = page.Next + "x"
+
+		_, err := paginator.SelectPage(context.Background(), db, &items, forged)
+
+		var webErr *web.Error
+		if !errors.As(err, &webErr) || webErr.HTTPCode != http.StatusBadRequest {
+			t.Fatalf("expected a bad request error but got %v", err)
+		}
+
+		otherSort := query
+		otherSort.SortKeys = []database.SortKey{{Column: "id"}}
+		otherSort.Cursor = page.Next
+
+		if _, err := paginator.SelectPage(context.Background(), db, &items, otherSort); err == nil {
+			t.Fatalf("expected a cursor of another sort order to be refused")
+		}
+	})
+}
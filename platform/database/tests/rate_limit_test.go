@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestRateLimitStore(t *testing.T) {
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "rate_limit.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	if err := database.MigrateWithOptions(db, []database.Migration{database.RateLimitsMigration(1)}, database.MigrationOptions{}); err != nil {
+		t.Fatalf("could not apply the migration: %v", err)
+	}
+
+	ctx := context.Background()
+	store := database.NewRateLimitStore(db)
+	limit := web.RateLimit{Requests: 2, Period: time.Hour}
+
+	t.Run("it allows the requests up to the limit", func(t *testing.T) {
+		for i := 0; i < limit.Requests; i++ {
+			result, err := store.Take(ctx, "orders:client-1", limit)
+			if err != nil {
+				t.Fatalf("could not take a token: %v", err)
+			}
+
+			if !result.Allowed || result.Remaining != limit.Requests-i-1 {
+				t.Fatalf("expected request %d to be allowed but got %#v", i, result)
+			}
+		}
+
+		result, err := store.Take(ctx, "orders:client-1", limit)
+		if err != nil {
+			t.Fatalf("could not take a token: %v", err)
+		}
+
+		if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 30*time.Minute {
+			t.Fatalf("expected the request to be throttled but got %#v", result)
+		}
+	})
+
+	t.Run("it limits each key independently", func(t *testing.T) {
+		result, err := store.Take(ctx, "orders:client-2", limit)
+		if err != nil || !result.Allowed {
+			t.Fatalf("expected the request to be allowed but got %#v: %v", result, err)
+		}
+	})
+
+	t.Run("it does not lose updates under concurrent requests", func(t *testing.T) {
+		concurrent := web.RateLimit{Requests: 5, Period: time.Hour}
+
+		var (
+			wg      sync.WaitGroup
+			mutex   sync.Mutex
+			allowed int
+		)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				result, err := store.Take(ctx, "orders:client-3", concurrent)
+				if err != nil {
+					t.Errorf("could not take a token: %v", err)
+					return
+				}
+
+				if result.Allowed {
+					mutex.Lock()
+					allowed++
+					mutex.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if allowed != concurrent.Requests {
+			t.Fatalf("expected %d requests to be allowed but got %d", concurrent.Requests, allowed)
+		}
+	})
+
+	t.Run("it purges the idle buckets", func(t *testing.T) {
+		purged, err := store.PurgeIdle(ctx, -time.Minute)
+		if err != nil {
+			t.Fatalf("could not purge the buckets: %v", err)
+		}
+
+		if purged != 3 {
+			t.Fatalf("expected 3 buckets to be purged but got %d", purged)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestReplicaSetDatabase(t *testing.T) {
+	cfg := loadConfig(t)
+
+	unreachableCfg := cfg
+	unreachableCfg.Port = 1
+
+	t.Run("it load-balances the queries across the working replicas", func(t *testing.T) {
+		replicaSetCfg := database.DefaultReplicaSetConfig
+		replicaSetCfg.Replicas = []database.Config{cfg, unreachableCfg, cfg}
+
+		db, err := database.ConnectReadReplicas(replicaSetCfg)
+		if err != nil {
+			t.Fatalf("could not connect to the replicas: %v", err)
+		}
+		defer db.Close()
+
+		for i := 0; i < 6; i++ {
+			var value int
+			if err := db.GetContext(context.Background(), &value, `SELECT 1`); err != nil {
+				t.Fatalf("query %d should have been sent to a working replica but got: %v", i, err)
+			}
+		}
+
+		status := db.HealthCheck("read-database")(context.Background())
+		if status.State != web.HealthzStateDegraded {
+			t.Fatalf("expected the replica set to be %s but got %s (%s)", web.HealthzStateDegraded, status.State, status.Error)
+		}
+
+		expectedMetadata := map[string]string{
+			"replica-0": string(web.HealthzStateHealthy),
+			"replica-1": string(web.HealthzStateUnhealthy),
+			"replica-2": string(web.HealthzStateHealthy),
+		}
+		for name, state := range expectedMetadata {
+			if status.Metadata[name] != state {
+				t.Fatalf("expected %s to be %s but got %s", name, state, status.Metadata[name])
+			}
+		}
+	})
+
+	t.Run("it is healthy when every replica works", func(t *testing.T) {
+		replicaSetCfg := database.DefaultReplicaSetConfig
+		replicaSetCfg.Replicas = []database.Config{cfg, cfg}
+
+		db, err := database.ConnectReadReplicas(replicaSetCfg)
+		if err != nil {
+			t.Fatalf("could not connect to the replicas: %v", err)
+		}
+		defer db.Close()
+
+		status := db.HealthCheck("read-database")(context.Background())
+		if status.State != web.HealthzStateHealthy {
+			t.Fatalf("expected the replica set to be %s but got %s (%s)", web.HealthzStateHealthy, status.State, status.Error)
+		}
+	})
+
+	t.Run("it falls back to the primary when every replica is ejected", func(t *testing.T) {
+		primaryCfg := cfg
+
+		replicaSetCfg := database.DefaultReplicaSetConfig
+		replicaSetCfg.Replicas = []database.Config{unreachableCfg}
+		replicaSetCfg.Primary = &primaryCfg
+
+		db, err := database.ConnectReadReplicas(replicaSetCfg)
+		if err != nil {
+			t.Fatalf("could not connect to the replicas: %v", err)
+		}
+		defer db.Close()
+
+		var value int
+		if err := db.GetContext(context.Background(), &value, `SELECT 1`); err != nil {
+			t.Fatalf("query should have been sent to the primary but got: %v", err)
+		}
+
+		status := db.HealthCheck("read-database")(context.Background())
+		if status.State != web.HealthzStateDegraded {
+			t.Fatalf("expected the replica set to be %s but got %s (%s)", web.HealthzStateDegraded, status.State, status.Error)
+		}
+	})
+
+	t.Run("it fails to connect when no replica can be reached", func(t *testing.T) {
+		replicaSetCfg := database.DefaultReplicaSetConfig
+		replicaSetCfg.Replicas = []database.Config{unreachableCfg}
+
+		if _, err := database.ConnectReadReplicas(replicaSetCfg); err == nil {
+			t.Fatalf("expected an error when no replica can be reached")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+)
+
+func TestSandboxProvider(t *testing.T) {
+	cfg := loadConfig(t)
+
+	provider := database.NewSandboxProvider(cfg, []database.Migration{
+		{
+			Version:     1,
+			Description: "Create the provider table",
+			Script:      `CREATE TABLE provider_data (id INTEGER PRIMARY KEY, code TEXT NOT NULL UNIQUE)`,
+		},
+	}, database.MigrationOptions{})
+
+	defer func() {
+		if err := provider.Close(); err != nil {
+			t.Fatalf("could not close the provider: %v", err)
+		}
+	}()
+
+	t.Run("every test gets its own migrated database", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			i := i
+
+			t.Run(fmt.Sprintf("test %d", i), func(t *testing.T) {
+				t.Parallel()
+
+				db, err := provider.Connect()
+				if err != nil {
+					t.Fatalf("could not get a sandbox database: %v", err)
+				}
+				defer db.Close()
+
+				if _, err := db.ExecContext(context.Background(), `INSERT INTO provider_data (id, code) VALUES ($1, $2)`, 1, "same_code"); err != nil {
+					t.Fatalf("the insert should not conflict with the other tests but got: %v", err)
+				}
+
+				var count int
+				if err := db.GetContext(context.Background(), &count, `SELECT COUNT(*) FROM provider_data`); err != nil {
+					t.Fatalf("could not count the rows: %v", err)
+				}
+
+				if count != 1 {
+					t.Fatalf("expected the database to only contain the row of this test but got %d rows", count)
+				}
+			})
+		}
+	})
+
+	t.Run("a clone can be shared by several connections", func(t *testing.T) {
+		cloneConfig, drop, err := provider.Clone()
+		if err != nil {
+			t.Fatalf("could not clone the database: %v", err)
+		}
+
+		db, err := database.Connect(cloneConfig)
+		if err != nil {
+			t.Fatalf("could not connect to the clone: %v", err)
+		}
+
+		if _, err := db.ExecContext(context.Background(), `INSERT INTO provider_data (id, code) VALUES ($1, $2)`, 1, "shared"); err != nil {
+			t.Fatalf("could not insert in the clone: %v", err)
+		}
+
+		db.Close()
+
+		if err := drop(); err != nil {
+			t.Fatalf("could not drop the clone: %v", err)
+		}
+	})
+
+	t.Run("the clone is dropped on close", func(t *testing.T) {
+		db, err := provider.Connect()
+		if err != nil {
+			t.Fatalf("could not get a sandbox database: %v", err)
+		}
+
+		var name string
+		if err := db.GetContext(context.Background(), &name, `SELECT current_database()`); err != nil {
+			t.Fatalf("could not get the database name: %v", err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatalf("could not close the sandbox database: %v", err)
+		}
+
+		admin, err := database.Connect(cfg)
+		if err != nil {
+			t.Fatalf("could not connect to DB: %v", err)
+		}
+		defer admin.Close()
+
+		var exists bool
+		if err := admin.GetContext(context.Background(), &exists, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, name); err != nil {
+			t.Fatalf("could not check the database existence: %v", err)
+		}
+
+		if exists {
+			t.Fatalf("expected the database %s to be dropped", name)
+		}
+	})
+}
@@ -3,9 +3,7 @@ package tests
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"os"
 	"reflect"
 	"testing"
 
@@ -28,20 +26,8 @@ func TestSandboxDatabase(t *testing.T) {
 			t.Fatalf("should not have panicked but got panic with %#v", err)
 		}
 	}()
-	cfgfile, err := os.Open("./testdata/databaseConfig.json")
-	if err != nil {
-		t.Fatalf("can't open databaseConfig file: %#v", err)
-	}
-
-	cfg := database.DefaultConfig
-
-	if err := json.NewDecoder(cfgfile).Decode(&cfg); err != nil {
-		t.Fatalf("can't parse file: %#v", err)
-	}
-
 	t.Run("ExecContext", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -141,8 +127,7 @@ func TestSandboxDatabase(t *testing.T) {
 	})
 
 	t.Run("NamedExecContext", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -241,8 +226,7 @@ func TestSandboxDatabase(t *testing.T) {
 	})
 
 	t.Run("GetContext previously inserted data", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -319,8 +303,7 @@ func TestSandboxDatabase(t *testing.T) {
 	})
 
 	t.Run("SelectContext previously inserted data", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -441,8 +424,7 @@ func TestSandboxDatabase(t *testing.T) {
 	})
 
 	t.Run("SelectMultipleContext previously inserted data", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := cloneDatabase(t, provider)
 		sqlxDB, err := connect(cfg)
 		if err != nil {
 			t.Fatalf("could not create sqlx connection: %#v", err)
@@ -592,7 +574,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when everything works in the transaction it can be commited",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -604,7 +586,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when something fails in the transaction it cannot be commited",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						firstData,
@@ -616,7 +598,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when everything works in the transaction but it has been manually rollbacked it cannot be commited",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -629,7 +611,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when a transaction has already been commited it cannot be commited again",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -642,8 +624,7 @@ func TestSandboxDatabase(t *testing.T) {
 		}
 		doTest := func(tc testCase, t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
-				cleanup := migrate(cfg, t)
-				defer cleanup()
+				cfg := cloneDatabase(t, provider)
 				sqlxDB, err := connect(cfg)
 				if err != nil {
 					t.Fatalf("could not create sqlx connection: %#v", err)
@@ -738,7 +719,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when a transaction is rollbacked data is not saved",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -750,7 +731,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when something fails in the transaction it can be rollbacked",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						firstData,
@@ -762,7 +743,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when a transaction is already committed, rollbacking has no effect",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -775,7 +756,7 @@ func TestSandboxDatabase(t *testing.T) {
 			{
 				name: "when a transaction has already been rollbacked it cannot be rollbacked again",
 				transaction: func(tx database.Tx, t *testing.T) {
-					_, err = tx.NamedExecContext(
+					tx.NamedExecContext(
 						context.Background(),
 						`INSERT INTO test_data (id, code) VALUES (:id, :code)`,
 						secondData,
@@ -788,8 +769,7 @@ func TestSandboxDatabase(t *testing.T) {
 		}
 		doTest := func(tc testCase, t *testing.T) {
 			t.Run(tc.name, func(t *testing.T) {
-				cleanup := migrate(cfg, t)
-				defer cleanup()
+				cfg := cloneDatabase(t, provider)
 				sqlxDB, err := connect(cfg)
 				if err != nil {
 					t.Fatalf("could not create sqlx connection: %#v", err)
@@ -876,8 +856,7 @@ func TestSandboxDatabase(t *testing.T) {
 	})
 
 	t.Run("Connect to a write and read database", func(t *testing.T) {
-		cleanup := migrate(cfg, t)
-		defer cleanup()
+		cfg := loadConfig(t)
 
 		runInsertTest := func(db database.WriteDB, data testData) (err error) {
 			ctx := context.Background()
@@ -959,6 +938,8 @@ func TestSandboxDatabase(t *testing.T) {
 			sandboxWriteDB.Close()
 		}()
 
+		migrate(t, sandboxWriteDB)
+
 		thirdData := testData{
 			ID:   "ee320876-5b21-416b-bf4c-8c8a5dfd4727",
 			Code: "third_data",
@@ -986,3 +967,81 @@ func TestSandboxDatabase(t *testing.T) {
 		}
 	})
 }
+
+func TestSandboxNestedTransactions(t *testing.T) {
+	db, err := database.SandboxConnect(loadConfig(t))
+	if err != nil {
+		t.Fatalf("could not connect to the sandbox: %v", err)
+	}
+	defer db.Close()
+
+	migrate(t, db)
+
+	insert := func(tx database.Tx, id string) {
+		if _, err := tx.ExecContext(context.Background(), `INSERT INTO test_data (id, code) VALUES ($1, $2)`, id, "nested"); err != nil {
+			t.Fatalf("could not insert: %v", err)
+		}
+	}
+
+	count := func() int {
+		var count int
+		if err := db.GetContext(context.Background(), &count, `SELECT COUNT(*) FROM test_data`); err != nil {
+			t.Fatalf("could not count: %v", err)
+		}
+		return count
+	}
+
+	t.Run("rolling back an inner transaction keeps the outer one", func(t *testing.T) {
+		outer, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the outer transaction: %v", err)
+		}
+		insert(outer, "0b5c2e9c-5d5e-4a55-a0b1-7c5a2e1a4f01")
+
+		inner, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the inner transaction: %v", err)
+		}
+		insert(inner, "0b5c2e9c-5d5e-4a55-a0b1-7c5a2e1a4f02")
+
+		if err := inner.Rollback(); err != nil {
+			t.Fatalf("could not rollback the inner transaction: %v", err)
+		}
+
+		if err := outer.Commit(); err != nil {
+			t.Fatalf("could not commit the outer transaction: %v", err)
+		}
+
+		if count() != 1 {
+			t.Fatalf("expected only the row of the outer transaction to be kept")
+		}
+	})
+
+	t.Run("ending an outer transaction before an inner one is an error", func(t *testing.T) {
+		outer, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the outer transaction: %v", err)
+		}
+
+		inner, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the inner transaction: %v", err)
+		}
+
+		if err := outer.Commit(); err == nil {
+			t.Fatalf("expected the outer transaction not to be committed while the inner one is running")
+		}
+
+		if err := outer.Rollback(); err == nil {
+			t.Fatalf("expected the outer transaction not to be rollbacked while the inner one is running")
+		}
+
+		if err := inner.Commit(); err != nil {
+			t.Fatalf("could not commit the inner transaction: %v", err)
+		}
+
+		if err := outer.Rollback(); err != nil {
+			t.Fatalf("could not rollback the outer transaction: %v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestSchemaDrift(t *testing.T) {
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "drift.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	first := database.Migration{Version: 1, Description: "Create the first table", Script: `CREATE TABLE drift_first (id INTEGER PRIMARY KEY)`}
+	second := database.Migration{Version: 2, Description: "Create the second table", Script: `CREATE TABLE drift_second (id INTEGER PRIMARY KEY)`}
+	third := database.Migration{Version: 3, Description: "Create the third table", Script: `CREATE TABLE drift_third (id INTEGER PRIMARY KEY)`}
+
+	if err := database.MigrateWithOptions(db, []database.Migration{first, second}, database.MigrationOptions{Output: &bytes.Buffer{}}); err != nil {
+		t.Fatalf("could not apply the migrations: %v", err)
+	}
+
+	changed := second
+	changed.Script = `CREATE TABLE drift_second (id INTEGER PRIMARY KEY, name TEXT)`
+
+	tcs := []struct {
+		name          string
+		migrations    []database.Migration
+		expectedState web.HealthzState
+		expectedDrift database.SchemaDrift
+	}{
+		{
+			name:          "when the migration set is applied",
+			migrations:    []database.Migration{first, second},
+			expectedState: web.HealthzStateHealthy,
+		},
+		{
+			name:          "when the binary is more recent than the database",
+			migrations:    []database.Migration{first, second, third},
+			expectedState: web.HealthzStateUnhealthy,
+			expectedDrift: database.SchemaDrift{Pending: []float64{3}},
+		},
+		{
+			name:          "when the database is more recent than the binary",
+			migrations:    []database.Migration{first},
+			expectedState: web.HealthzStateDegraded,
+			expectedDrift: database.SchemaDrift{Missing: []float64{2}},
+		},
+		{
+			name:          "when an applied migration changed",
+			migrations:    []database.Migration{first, changed},
+			expectedState: web.HealthzStateUnhealthy,
+			expectedDrift: database.SchemaDrift{ChecksumMismatch: []float64{2}},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			drift, err := database.CheckSchema(db, tc.migrations)
+			if err != nil {
+				t.Fatalf("could not check the schema: %v", err)
+			}
+
+			if drift.String() != tc.expectedDrift.String() {
+				t.Fatalf("expected the drift %s but got %s", tc.expectedDrift, drift)
+			}
+
+			status := database.SchemaDriftHealthCheck(db, tc.migrations)(context.Background())
+			if status.State != tc.expectedState {
+				t.Fatalf("expected the state %s but got %s: %s", tc.expectedState, status.State, status.Error)
+			}
+
+			err = database.VerifySchema(db, tc.migrations, web.HealthzStateDegraded)
+			if tc.expectedState == web.HealthzStateUnhealthy && !errors.Is(err, database.ErrSchemaDrift) {
+				t.Fatalf("expected ErrSchemaDrift but got: %v", err)
+			}
+
+			if tc.expectedState != web.HealthzStateUnhealthy && err != nil {
+				t.Fatalf("expected the drift to be tolerated but got: %v", err)
+			}
+		})
+	}
+
+	t.Run("it refuses any drift when none is tolerated", func(t *testing.T) {
+		if err := database.VerifySchema(db, []database.Migration{first}, web.HealthzStateHealthy); !errors.Is(err, database.ErrSchemaDrift) {
+			t.Fatalf("expected ErrSchemaDrift but got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+)
+
+func TestSandboxSessionSettings(t *testing.T) {
+	cfg := loadConfig(t)
+
+	db, err := database.SandboxConnect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	currentTenant := func(t *testing.T, ctx context.Context, q interface {
+		GetContext(context.Context, interface{}, string, ...interface{}) error
+	}) string {
+		var tenantID string
+		if err := q.GetContext(ctx, &tenantID, `SELECT COALESCE(current_setting('app.tenant_id', true), '')`); err != nil {
+			t.Fatalf("could not read the tenant setting: %v", err)
+		}
+		return tenantID
+	}
+
+	tenantCtx := database.WithTenantID(context.Background(), "tenant-a")
+
+	t.Run("it applies the settings of the context to the statement", func(t *testing.T) {
+		if tenantID := currentTenant(t, tenantCtx, db); tenantID != "tenant-a" {
+			t.Fatalf("expected the tenant to be tenant-a but got %q", tenantID)
+		}
+	})
+
+	t.Run("it does not leak the settings to the next statements", func(t *testing.T) {
+		if tenantID := currentTenant(t, context.Background(), db); tenantID != "" {
+			t.Fatalf("expected no tenant but got %q", tenantID)
+		}
+	})
+
+	t.Run("it keeps the settings for the whole transaction", func(t *testing.T) {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		if tenantID := currentTenant(t, tenantCtx, tx); tenantID != "tenant-a" {
+			t.Fatalf("expected the tenant to be tenant-a but got %q", tenantID)
+		}
+
+		if tenantID := currentTenant(t, context.Background(), tx); tenantID != "tenant-a" {
+			t.Fatalf("expected the tenant to be kept in the transaction but got %q", tenantID)
+		}
+	})
+}
+
+func TestSessionSettingsUnsupportedDialect(t *testing.T) {
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "session.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(context.Background(), `SELECT 1`); err != nil {
+		t.Fatalf("expected the statement without settings to succeed but got: %v", err)
+	}
+
+	if _, err := db.ExecContext(database.WithTenantID(context.Background(), "tenant-a"), `SELECT 1`); err == nil {
+		t.Fatalf("expected an error as SQLite does not support session settings")
+	}
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	errUnauthorized := errors.New("unauthorized")
+
+	middleware := database.SessionMiddleware(func(ctx context.Context, r *http.Request, params map[string]string) (database.SessionSettings, error) {
+		tenantID := r.Header.Get("X-Tenant-ID")
+		if tenantID == "" {
+			return nil, errUnauthorized
+		}
+
+		return database.SessionSettings{database.TenantIDSetting: tenantID, database.UserIDSetting: params["user_id"]}, nil
+	})
+
+	var settings database.SessionSettings
+	handler := middleware(func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		settings = database.SessionSettingsFromContext(ctx)
+		return nil
+	})
+
+	t.Run("it adds the settings to the context of the handler", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Tenant-ID", "tenant-a")
+
+		ctx := database.WithSessionSettings(context.Background(), database.SessionSettings{"app.locale": "fr"})
+		if err := handler(ctx, httptest.NewRecorder(), r, map[string]string{"user_id": "user-a"}); err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		expected := database.SessionSettings{"app.locale": "fr", database.TenantIDSetting: "tenant-a", database.UserIDSetting: "user-a"}
+		if len(settings) != len(expected) {
+			t.Fatalf("expected the settings %v but got %v", expected, settings)
+		}
+
+		for name, value := range expected {
+			if settings[name] != value {
+				t.Fatalf("expected the settings %v but got %v", expected, settings)
+			}
+		}
+	})
+
+	t.Run("it returns the error of the identifier", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		if err := handler(context.Background(), httptest.NewRecorder(), r, nil); !errors.Is(err, errUnauthorized) {
+			t.Fatalf("expected the identifier error but got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+)
+
+func TestPostgresStatementTimeoutDataSourceName(t *testing.T) {
+	tcs := []struct {
+		name     string
+		config   database.Config
+		expected string
+	}{
+		{
+			name:     "when no timeout is configured",
+			config:   database.Config{URL: "postgres://localhost/db"},
+			expected: "postgres://localhost/db",
+		},
+		{
+			name:     "when a default timeout is configured on an URL",
+			config:   database.Config{URL: "postgres://localhost/db?sslmode=disable", StatementTimeout: 1500},
+			expected: "postgres://localhost/db?sslmode=disable&statement_timeout=1500",
+		},
+		{
+			name:     "when the maximum timeout is shorter than the default one",
+			config:   database.Config{URL: "postgres://localhost/db", StatementTimeout: 1500, MaxStatementTimeout: 1000},
+			expected: "postgres://localhost/db?statement_timeout=1000",
+		},
+		{
+			name:     "when only a maximum timeout is configured on a key value data source name",
+			config:   database.Config{URL: "host=localhost dbname=db", MaxStatementTimeout: 2000},
+			expected: "host=localhost dbname=db statement_timeout='2000'",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if dsn := (database.PostgresDialect{}).DataSourceName(tc.config); dsn != tc.expected {
+				t.Fatalf("expected %s but got %s", tc.expected, dsn)
+			}
+		})
+	}
+}
+
+func TestTransactionStatementTimeout(t *testing.T) {
+	cfg := loadConfig(t)
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("could not begin the transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	statementTimeout := func(ctx context.Context) string {
+		var value string
+		if err := tx.GetContext(ctx, &value, `SELECT current_setting('statement_timeout')`); err != nil {
+			t.Fatalf("could not read the statement timeout: %v", err)
+		}
+
+		return value
+	}
+
+	first := statementTimeout(ctx)
+	time.Sleep(20 * time.Millisecond)
+
+	if second := statementTimeout(ctx); second != first {
+		t.Fatalf("expected the statement timeout to be applied once but it changed from %s to %s", first, second)
+	}
+
+	shorter, cancelShorter := context.WithTimeout(context.Background(), time.Second)
+	defer cancelShorter()
+
+	if timeout := statementTimeout(shorter); timeout == first {
+		t.Fatalf("expected the statement timeout to be applied again for an earlier deadline")
+	}
+}
+
+func TestSandboxStatementTimeouts(t *testing.T) {
+	cfg := loadConfig(t)
+	cfg.StatementTimeout = 5000
+
+	db, err := database.SandboxConnect(cfg)
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	statementTimeout := func(t *testing.T, ctx context.Context) time.Duration {
+		var value string
+		if err := db.GetContext(ctx, &value, `SELECT current_setting('statement_timeout')`); err != nil {
+			t.Fatalf("could not read the statement timeout: %v", err)
+		}
+
+		timeout, err := time.ParseDuration(strings.Replace(value, "min", "m", 1))
+		if err != nil {
+			t.Fatalf("could not parse the statement timeout %s: %v", value, err)
+		}
+
+		return timeout
+	}
+
+	t.Run("it uses the default timeout without deadline", func(t *testing.T) {
+		if timeout := statementTimeout(t, context.Background()); timeout != 5*time.Second {
+			t.Fatalf("expected a statement timeout of 5s but got %s", timeout)
+		}
+	})
+
+	t.Run("it uses the time left before the deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		if timeout := statementTimeout(t, ctx); timeout <= 0 || timeout >= 2*time.Second {
+			t.Fatalf("expected a statement timeout shorter than 2s but got %s", timeout)
+		}
+
+		if timeout := statementTimeout(t, context.Background()); timeout != 5*time.Second {
+			t.Fatalf("expected the default timeout to be restored but got %s", timeout)
+		}
+	})
+
+	t.Run("it reports the statements cancelled by the server as retry-unsafe timeouts", func(t *testing.T) {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+
+		_, err = tx.ExecContext(ctx, `SELECT pg_sleep(2)`)
+
+		e := database.Classify(err)
+		if e == nil || e.Kind != database.ErrorKindTimeout || e.Retryable {
+			t.Fatalf("expected a retry-unsafe timeout but got: %#v", e)
+		}
+	})
+}
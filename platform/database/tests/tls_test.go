@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+)
+
+// writeTLSFiles writes a self-signed certificate and its key, returning their paths
+func writeTLSFiles(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate the key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "database.internal"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create the certificate: %v", err)
+	}
+
+	encodedKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not encode the key: %v", err)
+	}
+
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0644); err != nil {
+		t.Fatalf("could not write the certificate: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: encodedKey}), 0600); err != nil {
+		t.Fatalf("could not write the key: %v", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLSConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTLSFiles(t, dir)
+
+	notPEMFile := filepath.Join(dir, "not-pem.crt")
+	if err := os.WriteFile(notPEMFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("could not write the file: %v", err)
+	}
+
+	sharedKeyFile := filepath.Join(dir, "shared.key")
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatalf("could not read the key: %v", err)
+	}
+
+	if err := os.WriteFile(sharedKeyFile, key, 0644); err != nil {
+		t.Fatalf("could not write the key: %v", err)
+	}
+
+	tcs := []struct {
+		name          string
+		config        database.Config
+		expectedError string
+	}{
+		{
+			name:          "when the mode is misspelled",
+			config:        database.Config{Driver: "postgres", TLS: database.TLSConfig{Mode: "verify_full"}},
+			expectedError: `unknown mode "verify_full"`,
+		},
+		{
+			name:          "when the driver does not support TLS",
+			config:        database.Config{Driver: "sqlite3", TLS: database.TLSConfig{Mode: database.TLSModeRequire}},
+			expectedError: "the sqlite3 driver does not support it",
+		},
+		{
+			name:          "when the certificate is defined without its key",
+			config:        database.Config{Driver: "postgres", TLS: database.TLSConfig{Mode: database.TLSModeVerifyFull, CertFile: certFile}},
+			expectedError: "cert_file and key_file must be defined together",
+		},
+		{
+			name:          "when the certificate authority is not a PEM file",
+			config:        database.Config{Driver: "postgres", TLS: database.TLSConfig{Mode: database.TLSModeVerifyCA, CAFile: notPEMFile}},
+			expectedError: "does not contain any PEM certificate",
+		},
+		{
+			name:          "when the key is readable by other users",
+			config:        database.Config{Driver: "postgres", TLS: database.TLSConfig{Mode: database.TLSModeVerifyFull, CertFile: certFile, KeyFile: sharedKeyFile}},
+			expectedError: "chmod 600",
+		},
+		{
+			name:          "when the server name is defined without full verification",
+			config:        database.Config{Driver: "postgres", TLS: database.TLSConfig{Mode: database.TLSModeRequire, ServerName: "database.internal"}},
+			expectedError: "server_name is only checked with the verify-full mode",
+		},
+		{
+			name:          "when the options conflict with the tls settings",
+			config:        database.Config{Driver: "postgres", Options: map[string]string{"sslmode": "disable"}, TLS: database.TLSConfig{Mode: database.TLSModeRequire}},
+			expectedError: "options.sslmode conflicts with the tls settings",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := database.Connect(tc.config)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Fatalf("expected an error containing %q but got: %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestPostgresTLSDataSourceName(t *testing.T) {
+	config := database.DefaultConfig
+	config.Host = "10.0.0.1"
+	config.TLS = database.TLSConfig{
+		Mode:       database.TLSModeVerifyFull,
+		CAFile:     "/etc/ssl/ca.crt",
+		CertFile:   "/etc/ssl/client.crt",
+		KeyFile:    "/etc/ssl/client.key",
+		ServerName: "database.internal",
+	}
+
+	dsn := (database.PostgresDialect{}).DataSourceName(config)
+
+	for _, expected := range []string{"@database.internal:5432", "sslmode=verify-full", "sslrootcert=%2Fetc%2Fssl%2Fca.crt", "sslcert=%2Fetc%2Fssl%2Fclient.crt", "sslkey=%2Fetc%2Fssl%2Fclient.key"} {
+		if !strings.Contains(dsn, expected) {
+			t.Fatalf("expected %s to contain %s", dsn, expected)
+		}
+	}
+}
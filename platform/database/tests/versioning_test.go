@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/database"
+	_ "github.com/fewlinesco/go-pkg/platform/database/sqlite"
+)
+
+func TestUpdateVersioned(t *testing.T) {
+	db, err := database.Connect(database.Config{Driver: "sqlite3", Database: filepath.Join(t.TempDir(), "versioning.db")})
+	if err != nil {
+		t.Fatalf("could not connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE documents (id TEXT PRIMARY KEY, title TEXT NOT NULL, version INTEGER NOT NULL DEFAULT 1)`); err != nil {
+		t.Fatalf("could not create the table: %v", err)
+	}
+
+	if _, err := db.ExecContext(ctx, `INSERT INTO documents (id, title) VALUES ('doc', 'first')`); err != nil {
+		t.Fatalf("could not insert the document: %v", err)
+	}
+
+	update := func(db database.VersionedExecer, version int64, title string) (int64, error) {
+		return database.UpdateVersioned(ctx, db, database.VersionedUpdate{
+			Table:   "documents",
+			ID:      "doc",
+			Version: version,
+			Values:  map[string]interface{}{"title": title},
+		})
+	}
+
+	t.Run("it updates the row and increments its version when the version matches", func(t *testing.T) {
+		version, err := update(db, 1, "second")
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		if version != 2 {
+			t.Fatalf("expected the new version to be 2 but got %d", version)
+		}
+	})
+
+	t.Run("it returns ErrStaleVersion when the version does not match", func(t *testing.T) {
+		version, err := update(db, 1, "concurrent")
+		if !errors.Is(err, database.ErrStaleVersion) {
+			t.Fatalf("expected ErrStaleVersion but got: %v", err)
+		}
+
+		if version != 2 {
+			t.Fatalf("expected the current version to be returned but got %d", version)
+		}
+
+		var title string
+		if err := db.GetContext(ctx, &title, `SELECT title FROM documents WHERE id = 'doc'`); err != nil {
+			t.Fatalf("could not read the document: %v", err)
+		}
+
+		if title != "second" {
+			t.Fatalf("expected the stale update to be ignored but the title is %s", title)
+		}
+
+		webErr := database.NewErrorMapper().WebError(err)
+		if webErr == nil || webErr.HTTPCode != http.StatusConflict {
+			t.Fatalf("expected the stale version to be mapped to a conflict but got %v", webErr)
+		}
+	})
+
+	t.Run("it returns sql.ErrNoRows when the row does not exist", func(t *testing.T) {
+		_, err := database.UpdateVersioned(ctx, db, database.VersionedUpdate{Table: "documents", ID: "missing", Version: 1})
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows but got: %v", err)
+		}
+	})
+
+	t.Run("it runs inside a transaction", func(t *testing.T) {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatalf("could not begin the transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		version, err := update(tx, 2, "third")
+		if err != nil || version != 3 {
+			t.Fatalf("expected version 3 but got %d with error: %v", version, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("could not commit the transaction: %v", err)
+		}
+	})
+
+	t.Run("it quotes the column names so that they can't alter the statement", func(t *testing.T) {
+		_, err := database.UpdateVersioned(ctx, db, database.VersionedUpdate{
+			Table:   "documents",
+			ID:      "doc",
+			Version: 3,
+			Values:  map[string]interface{}{"title = 'injected', version": 42},
+		})
+		if err == nil {
+			t.Fatalf("expected the unknown column to be rejected")
+		}
+
+		var title string
+		if err := db.GetContext(ctx, &title, `SELECT title FROM documents WHERE id = 'doc'`); err != nil {
+			t.Fatalf("could not read the document: %v", err)
+		}
+
+		if title != "third" {
+			t.Fatalf("expected the document to be left untouched but the title is %s", title)
+		}
+	})
+}
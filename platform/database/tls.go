@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql/driver"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TLSMode tells whether the connections to the server are encrypted and how the server certificate is verified
+type TLSMode string
+
+const (
+	// TLSModeDisable opens unencrypted connections
+	TLSModeDisable TLSMode = "disable"
+	// TLSModeRequire encrypts the connections without verifying the server certificate
+	TLSModeRequire TLSMode = "require"
+	// TLSModeVerifyCA encrypts the connections and checks the server certificate is signed by a trusted authority
+	TLSModeVerifyCA TLSMode = "verify-ca"
+	// TLSModeVerifyFull also checks the server certificate is issued for the server name, which defaults to the host
+	TLSModeVerifyFull TLSMode = "verify-full"
+)
+
+var tlsModes = []TLSMode{TLSModeDisable, TLSModeRequire, TLSModeVerifyCA, TLSModeVerifyFull}
+
+// TLSConfig describes the encryption of the connections. The files are read by the driver when a connection is opened
+// but they are validated by Connect so that a misconfiguration is reported at startup. The certificate authority
+// defaults to the system ones and the client certificate is optional. ServerName is the name checked in the server
+// certificate with TLSModeVerifyFull when the server is reached through another host name, e.g. an IP address.
+type TLSConfig struct {
+	Mode       TLSMode `json:"mode"`
+	CAFile     string  `json:"ca_file"`
+	CertFile   string  `json:"cert_file"`
+	KeyFile    string  `json:"key_file"`
+	ServerName string  `json:"server_name"`
+}
+
+func (config TLSConfig) isZero() bool {
+	return config == TLSConfig{}
+}
+
+// validateTLS checks the TLS configuration, reporting the first issue with the name of the offending setting
+func validateTLS(config Config, dialect Dialect) error {
+	settings := config.TLS
+	if settings.isZero() {
+		return nil
+	}
+
+	if dialect.DriverName() != (PostgresDialect{}).DriverName() {
+		return fmt.Errorf("invalid tls configuration: the %s driver does not support it", dialect.DriverName())
+	}
+
+	for _, option := range []string{"sslmode", "sslrootcert", "sslcert", "sslkey"} {
+		if _, ok := config.Options[option]; ok {
+			return fmt.Errorf("invalid tls configuration: options.%s conflicts with the tls settings, remove it", option)
+		}
+	}
+
+	validMode := false
+	modes := make([]string, len(tlsModes))
+	for i, mode := range tlsModes {
+		validMode = validMode || mode == settings.Mode
+		modes[i] = string(mode)
+	}
+
+	if !validMode {
+		return fmt.Errorf("invalid tls configuration: unknown mode %q, expected one of %s", settings.Mode, strings.Join(modes, ", "))
+	}
+
+	if settings.Mode == TLSModeDisable {
+		if settings != (TLSConfig{Mode: TLSModeDisable}) {
+			return fmt.Errorf("invalid tls configuration: the files and the server name are ignored when the mode is %s, remove them or change the mode", TLSModeDisable)
+		}
+
+		return nil
+	}
+
+	if settings.ServerName != "" {
+		if settings.Mode != TLSModeVerifyFull {
+			return fmt.Errorf("invalid tls configuration: server_name is only checked with the %s mode", TLSModeVerifyFull)
+		}
+
+		if config.URL != "" {
+			return fmt.Errorf("invalid tls configuration: server_name can't be used with url, define host and port instead")
+		}
+	}
+
+	if settings.CAFile != "" {
+		pem, err := os.ReadFile(settings.CAFile)
+		if err != nil {
+			return fmt.Errorf("invalid tls configuration: can't read ca_file: %v", err)
+		}
+
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return fmt.Errorf("invalid tls configuration: ca_file %s does not contain any PEM certificate", settings.CAFile)
+		}
+	}
+
+	if (settings.CertFile == "") != (settings.KeyFile == "") {
+		return fmt.Errorf("invalid tls configuration: cert_file and key_file must be defined together")
+	}
+
+	if settings.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile); err != nil {
+			return fmt.Errorf("invalid tls configuration: can't load the client certificate from cert_file and key_file: %v", err)
+		}
+
+		info, err := os.Stat(settings.KeyFile)
+		if err != nil {
+			return fmt.Errorf("invalid tls configuration: can't read key_file: %v", err)
+		}
+
+		// lib/pq refuses the keys readable by other users
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			return fmt.Errorf("invalid tls configuration: key_file %s must only be readable by its owner (chmod 600)", settings.KeyFile)
+		}
+	}
+
+	return nil
+}
+
+// postgresTLSParameters converts the TLS configuration to lib/pq parameters. With a server name, the host of the data
+// source name is replaced by the server name and the connections are dialed to the configured host instead.
+func postgresTLSParameters(settings TLSConfig) map[string]string {
+	if settings.isZero() {
+		return nil
+	}
+
+	parameters := map[string]string{"sslmode": string(settings.Mode)}
+
+	if settings.CAFile != "" {
+		parameters["sslrootcert"] = settings.CAFile
+	}
+
+	if settings.CertFile != "" {
+		parameters["sslcert"] = settings.CertFile
+		parameters["sslkey"] = settings.KeyFile
+	}
+
+	return parameters
+}
+
+// newTLSConnector returns a connector verifying the server certificate against the server name while connecting to
+// the configured host, or nil when the configuration does not need one
+func newTLSConnector(config Config, dataSourceName string) driver.Connector {
+	if config.TLS.ServerName == "" || config.TLS.ServerName == config.Host {
+		return nil
+	}
+
+	return &tlsConnector{
+		dataSourceName: dataSourceName,
+		address:        net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+	}
+}
+
+// withTLSServerName replaces the host of the configuration by the server name, as lib/pq checks the certificate
+// against the host it connects to
+func withTLSServerName(config Config) Config {
+	if config.TLS.ServerName != "" {
+		config.Host = config.TLS.ServerName
+	}
+
+	return config
+}
+
+type tlsConnector struct {
+	dataSourceName string
+	address        string
+}
+
+// Connect opens a lib/pq connection to the configured address
+func (connector *tlsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return pq.DialOpen(addressDialer{address: connector.address}, connector.dataSourceName)
+}
+
+// Driver returns the lib/pq driver
+func (connector *tlsConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// addressDialer dials a fixed address whatever the address asked for
+type addressDialer struct {
+	address string
+	dialer  net.Dialer
+}
+
+func (d addressDialer) Dial(network, _ string) (net.Conn, error) {
+	return d.dialer.Dial(network, d.address)
+}
+
+func (d addressDialer) DialTimeout(network, _ string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(network, d.address, timeout)
+}
+
+func (d addressDialer) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	return d.dialer.DialContext(ctx, network, d.address)
+}
+
+// connectionSecurity is the encryption of the connection reported by pg_stat_ssl
+type connectionSecurity struct {
+	Encrypted bool   `db:"ssl"`
+	Version   string `db:"version"`
+	Cipher    string `db:"cipher"`
+}
+
+const connectionSecurityQuery = `
+	SELECT ssl, COALESCE(version, '') AS version, COALESCE(cipher, '') AS cipher
+	FROM pg_stat_ssl
+	WHERE pid = pg_backend_pid()`
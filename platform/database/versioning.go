@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// DefaultVersionColumn is the column holding the version of a row when the update does not specify one
+	DefaultVersionColumn = "version"
+	// DefaultVersionIDColumn is the column identifying a row when the update does not specify one
+	DefaultVersionIDColumn = "id"
+)
+
+// ErrStaleVersion is returned by UpdateVersioned when the row has been updated since the given version was read.
+// It is classified as ErrorKindStaleVersion, which the DefaultErrorMappings map to a 409. Endpoints relying on the
+// `If-Match` header can map it to a 412 instead:
+//
+//	database.NewErrorMapper(database.ErrorMapping{
+//		Kind:     database.ErrorKindStaleVersion,
+//		HTTPCode: http.StatusPreconditionFailed,
+//		Message:  web.PreconditionFailedMessage,
+//	})
+var ErrStaleVersion = errors.New("the row has been updated since it was read")
+
+// VersionedExecer is implemented by the databases and transactions able to run a versioned update
+type VersionedExecer interface {
+	ExecContext(ctx context.Context, statement string, arg ...interface{}) (sql.Result, error)
+	GetContext(ctx context.Context, dest interface{}, statement string, args ...interface{}) error
+	Dialect() Dialect
+}
+
+// VersionedUpdate describes an update of the row identified by ID which only succeeds if the row is still at Version.
+// IDColumn and VersionColumn default to DefaultVersionIDColumn and DefaultVersionColumn. The table and the columns,
+// those of Values included, are quoted with Dialect.QuoteIdentifier and are therefore case-sensitive.
+type VersionedUpdate struct {
+	Table         string
+	IDColumn      string
+	ID            interface{}
+	VersionColumn string
+	Version       int64
+	Values        map[string]interface{}
+}
+
+// UpdateVersioned sets the values of the row and increments its version, provided it has not been updated since the
+// given version was read. It returns the new version of the row, ErrStaleVersion when the version does not match and
+// sql.ErrNoRows when the row does not exist, both wrapped.
+func UpdateVersioned(ctx context.Context, db VersionedExecer, update VersionedUpdate) (int64, error) {
+	idColumn := update.IDColumn
+	if idColumn == "" {
+		idColumn = DefaultVersionIDColumn
+	}
+
+	versionColumn := update.VersionColumn
+	if versionColumn == "" {
+		versionColumn = DefaultVersionColumn
+	}
+
+	dialect := db.Dialect()
+	table := dialect.QuoteIdentifier(update.Table)
+	idColumn = dialect.QuoteIdentifier(idColumn)
+	versionColumn = dialect.QuoteIdentifier(versionColumn)
+
+	columns := make([]string, 0, len(update.Values))
+	for column := range update.Values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	assignments := make([]string, 0, len(columns)+1)
+	args := make([]interface{}, 0, len(columns)+2)
+
+	for _, column := range columns {
+		assignments = append(assignments, fmt.Sprintf("%s = ?", dialect.QuoteIdentifier(column)))
+		args = append(args, update.Values[column])
+	}
+
+	assignments = append(assignments, fmt.Sprintf("%[1]s = %[1]s + 1", versionColumn))
+	args = append(args, update.ID, update.Version)
+
+	bindType := sqlx.BindType(dialect.DriverName())
+
+	statement := sqlx.Rebind(bindType, fmt.Sprintf("UPDATE %s SET %s WHERE %s = ? AND %s = ?", table, strings.Join(assignments, ", "), idColumn, versionColumn))
+
+	result, err := db.ExecContext(ctx, statement, args...)
+	if err != nil {
+		return 0, fmt.Errorf("can't update %s %v: %w", update.Table, update.ID, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't update %s %v: %w", update.Table, update.ID, err)
+	}
+
+	if affected > 0 {
+		return update.Version + 1, nil
+	}
+
+	var current int64
+	if err := db.GetContext(ctx, &current, sqlx.Rebind(bindType, fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", versionColumn, table, idColumn)), update.ID); err != nil {
+		return 0, fmt.Errorf("can't update %s %v: %w", update.Table, update.ID, err)
+	}
+
+	return current, fmt.Errorf("%w: %s %v is at version %d, not %d", ErrStaleVersion, update.Table, update.ID, current, update.Version)
+}
@@ -26,6 +26,11 @@ func ViewCount() *ViewAggregation {
 	return &ViewAggregation{view.Count()}
 }
 
+// ViewSum organizes a view where the measured values are added up, e.g. a number of processed items.
+func ViewSum() *ViewAggregation {
+	return &ViewAggregation{view.Sum()}
+}
+
 // measurer reprensents how we get a measurement from the underlying opencensus library
 // It's used internally to cast our structs to opencsensus structs
 type measurer interface {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/GuiaBolso/darwin"
 	"github.com/fewlinesco/go-pkg/platform"
+	"github.com/fewlinesco/go-pkg/platform/database"
 )
 
 type cqrsTest struct {
@@ -15,8 +16,6 @@ type cqrsTest struct {
 
 func TestCQRSApplication(t *testing.T) {
 	// SETUP
-	cleanMigrationQuery := `DROP TABLE IF EXISTS darwin_migrations`
-
 	migrations := []darwin.Migration{
 		{
 			Version:     1,
@@ -24,7 +23,8 @@ func TestCQRSApplication(t *testing.T) {
 			Script: `CREATE TABLE cqrs_test (
 				id SERIAL,
 				value VARCHAR NOT NULL
-			);`,
+			);
+			GRANT SELECT ON cqrs_test TO reader_user;`,
 		},
 	}
 
@@ -35,15 +35,25 @@ func TestCQRSApplication(t *testing.T) {
 		t.Fatalf("Could not read the configuration: %v", err)
 	}
 
-	cqrsApplication, err := platform.NewCQRSApplication(cqrsAppConfig)
+	// the test runs on a database of its own so that it can run along the tests of the other packages
+	provider := database.NewSandboxProvider(cqrsAppConfig.WriteDatabase, nil, database.MigrationOptions{})
+	defer provider.Close()
+
+	cloneConfig, drop, err := provider.Clone()
 	if err != nil {
-		t.Fatalf("Could not create the application: %v", err)
+		t.Fatalf("Could not clone the database: %v", err)
 	}
+	defer drop()
+
+	cqrsAppConfig.WriteDatabase = cloneConfig
+	cqrsAppConfig.ReadDatabase.Database = cloneConfig.Database
 
-	_, err = cqrsApplication.WriteDatabase.ExecContext(context.Background(), cleanMigrationQuery)
+	cqrsApplication, err := platform.NewCQRSApplication(cqrsAppConfig)
 	if err != nil {
-		t.Fatalf("Unable to clean migration table: %v", err)
+		t.Fatalf("Could not create the application: %v", err)
 	}
+	defer cqrsApplication.ReadDatabase.Close()
+	defer cqrsApplication.WriteDatabase.Close()
 
 	err = cqrsApplication.StartMigrations(migrations)
 	if err != nil {
@@ -71,22 +81,4 @@ func TestCQRSApplication(t *testing.T) {
 			t.Fatalf("Should not be able to write with the Read database")
 		}
 	})
-
-	// CLEANING
-	migrations = append(migrations, darwin.Migration{
-		Version:     2,
-		Description: "Delete the cqrs test table",
-		Script:      `DROP TABLE cqrs_test`,
-	})
-
-	err = cqrsApplication.StartMigrations(migrations)
-	if err != nil {
-		t.Fatalf("could not migrate the Database: %v", err)
-	}
-
-	_, err = cqrsApplication.WriteDatabase.ExecContext(context.Background(), cleanMigrationQuery)
-	if err != nil {
-		t.Fatalf("Unable to clean migration table: %v", err)
-	}
-
 }
@@ -0,0 +1,222 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultCORSMethods are the methods allowed when the CORSPolicy does not specify them
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	// DefaultCORSHeaders are the request headers allowed when the CORSPolicy does not specify them
+	DefaultCORSHeaders = []string{"Accept", "Content-Type"}
+)
+
+// CORSPolicy describes the cross-origin requests a browser is allowed to make.
+// AllowedOrigins are either `*`, which allows every origin, or origins which may contain one wildcard such as
+// `https://*.example.com`. As browsers refuse credentials for every origin, AllowCredentials only applies to the
+// origins matched by the other patterns.
+// AllowedMethods and AllowedHeaders default to DefaultCORSMethods and DefaultCORSHeaders, AllowedHeaders may be `*`.
+// ExposedHeaders are the response headers the browser gives access to and MaxAge the time a preflight response is
+// cached by the browser.
+type CORSPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+func (policy CORSPolicy) allowedOrigin(origin string) (string, bool) {
+	origin = strings.ToLower(origin)
+	anyOrigin := false
+
+	for _, pattern := range policy.AllowedOrigins {
+		pattern = strings.ToLower(pattern)
+
+		if pattern == "*" {
+			anyOrigin = true
+			continue
+		}
+
+		if matchOrigin(pattern, origin) {
+			return origin, true
+		}
+	}
+
+	if anyOrigin {
+		return "*", true
+	}
+
+	return "", false
+}
+
+func matchOrigin(pattern string, origin string) bool {
+	wildcard := strings.Index(pattern, "*")
+	if wildcard < 0 {
+		return pattern == origin
+	}
+
+	prefix, suffix := pattern[:wildcard], pattern[wildcard+1:]
+
+	return len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+func (policy CORSPolicy) methods() []string {
+	if len(policy.AllowedMethods) == 0 {
+		return DefaultCORSMethods
+	}
+
+	return policy.AllowedMethods
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, allowed := range methods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (policy CORSPolicy) allowsHeaders(headers []string) bool {
+	allowedHeaders := policy.AllowedHeaders
+	if len(allowedHeaders) == 0 {
+		allowedHeaders = DefaultCORSHeaders
+	}
+
+	for _, header := range headers {
+		allowed := false
+		for _, allowedHeader := range allowedHeaders {
+			allowed = allowed || allowedHeader == "*" || strings.EqualFold(allowedHeader, header)
+		}
+
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CORSMiddleware applies the policy to the cross-origin requests. It is meant to be given to NewRouter or
+// NewSubRouter: the preflight requests are answered for every route registered on the router, with the methods both
+// registered for the route and allowed by the policy, and the policy of a sub router replaces the one of its parent. Requests which are not allowed by the policy are handled without any
+// CORS header so that the browser blocks them.
+func CORSMiddleware(policy CORSPolicy) Middleware {
+	return func(before Handler) Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return before(ctx, w, r, params)
+			}
+
+			header := w.Header()
+			for name := range header {
+				if strings.HasPrefix(name, "Access-Control-") {
+					header.Del(name)
+				}
+			}
+
+			addVary(header, "Origin")
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				addVary(header, "Access-Control-Request-Method")
+				addVary(header, "Access-Control-Request-Headers")
+			}
+
+			allowedOrigin, ok := policy.allowedOrigin(origin)
+			if !ok {
+				return before(ctx, w, r, params)
+			}
+
+			if preflight {
+				methods := policy.methods()
+				if route, ok := ctx.Value(keyPreflightRoute).(*preflightRoute); ok {
+					methods = route.allowedMethods(methods)
+				}
+
+				requestedHeaders := splitHeaderValues(r.Header.Get("Access-Control-Request-Headers"))
+				if !containsMethod(methods, r.Header.Get("Access-Control-Request-Method")) || !policy.allowsHeaders(requestedHeaders) {
+					return before(ctx, w, r, params)
+				}
+
+				header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				if len(requestedHeaders) > 0 {
+					header.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+				}
+
+				if policy.MaxAge > 0 {
+					header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+				}
+			} else if len(policy.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+
+			header.Set("Access-Control-Allow-Origin", allowedOrigin)
+			if policy.AllowCredentials && allowedOrigin != "*" {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			return before(ctx, w, r, params)
+		}
+
+		return h
+	}
+}
+
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, existing := range splitHeaderValues(value) {
+			if strings.EqualFold(existing, name) {
+				return
+			}
+		}
+	}
+
+	header.Add("Vary", name)
+}
+
+func splitHeaderValues(value string) []string {
+	var values []string
+
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+
+	return values
+}
+
+// preflightRoute answers the OPTIONS requests of a path registered without an OPTIONS handler, listing the methods
+// registered for it
+type preflightRoute struct {
+	methods  []string
+	explicit bool
+}
+
+func (route *preflightRoute) handle(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+	w.Header().Set("Allow", strings.Join(append(append([]string{}, route.methods...), http.MethodOptions), ", "))
+
+	return Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// allowedMethods returns the methods registered for the route among the given ones
+func (route *preflightRoute) allowedMethods(methods []string) []string {
+	var allowed []string
+
+	for _, method := range methods {
+		if containsMethod(route.methods, method) {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return allowed
+}
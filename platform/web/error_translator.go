@@ -0,0 +1,36 @@
+package web
+
+import (
+	"sync"
+)
+
+// ErrorTranslator converts an error which does not wrap a web.Error, e.g. an error returned by a database driver,
+// to a web.Error. It returns nil for the errors it does not handle.
+type ErrorTranslator func(err error) *Error
+
+var (
+	errorTranslatorsMutex sync.RWMutex
+	errorTranslators      []ErrorTranslator
+)
+
+// RegisterErrorTranslator makes RespondError use the translator for the errors which do not wrap a web.Error.
+// Translators are tried in their registration order until one of them handles the error.
+func RegisterErrorTranslator(translator ErrorTranslator) {
+	errorTranslatorsMutex.Lock()
+	defer errorTranslatorsMutex.Unlock()
+
+	errorTranslators = append(errorTranslators, translator)
+}
+
+func translateError(err error) *Error {
+	errorTranslatorsMutex.RLock()
+	defer errorTranslatorsMutex.RUnlock()
+
+	for _, translator := range errorTranslators {
+		if webErr := translator(err); webErr != nil {
+			return webErr
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PreconditionFailedMessage is the error message we return when the `If-Match` header does not match the current
+// version of the resource
+var PreconditionFailedMessage = NewErrorMessage("412000", "the resource has been modified since it was read")
+
+// NewErrPreconditionFailed is returned when the `If-Match` header does not match the current version of the resource
+func NewErrPreconditionFailed() error {
+	return &Error{
+		HTTPCode:     http.StatusPreconditionFailed,
+		ErrorMessage: PreconditionFailedMessage,
+	}
+}
+
+// ETag formats the version of a resource as a strong entity tag, e.g. `"3"`
+func ETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// SetETag sets the `ETag` header of the response to the version of the resource
+func SetETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", ETag(version))
+}
+
+// IfMatch is the condition of the `If-Match` header. Any is true for `If-Match: *`, which matches any current version
+// of the resource, otherwise the header matches when one of the Versions is the current one.
+type IfMatch struct {
+	Any      bool
+	Versions []int64
+}
+
+// Matches tells whether the current version of the resource satisfies the condition
+func (condition IfMatch) Matches(version int64) bool {
+	if condition.Any {
+		return true
+	}
+
+	for _, expected := range condition.Versions {
+		if expected == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseIfMatch reads the versions of the resource the client expects from the `If-Match` header, either `*` or a list
+// of entity tags. The boolean is false when the header is missing so that handlers can decide whether it is required.
+// Weak entity tags and tags which are not versions never match as the comparison is strong (RFC 7232 §3.1). A header
+// which can't match any version, e.g. only weak or malformed entity tags, is reported as a wrapped
+// NewErrPreconditionFailed.
+func ParseIfMatch(r *http.Request) (IfMatch, bool, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return IfMatch{}, false, nil
+	}
+
+	if header == "*" {
+		return IfMatch{Any: true}, true, nil
+	}
+
+	var condition IfMatch
+
+	for rest := header; rest != ""; {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+
+		weak := strings.HasPrefix(rest, "W/")
+		if weak {
+			rest = rest[2:]
+		}
+
+		if !strings.HasPrefix(rest, `"`) {
+			return IfMatch{}, true, fmt.Errorf("%w", NewErrPreconditionFailed())
+		}
+
+		end := strings.Index(rest[1:], `"`)
+		if end < 0 {
+			return IfMatch{}, true, fmt.Errorf("%w", NewErrPreconditionFailed())
+		}
+
+		tag := rest[1 : end+1]
+		rest = rest[end+2:]
+
+		if weak {
+			continue
+		}
+
+		if version, err := strconv.ParseInt(tag, 10, 64); err == nil {
+			condition.Versions = append(condition.Versions, version)
+		}
+	}
+
+	if len(condition.Versions) == 0 {
+		return IfMatch{}, true, fmt.Errorf("%w", NewErrPreconditionFailed())
+	}
+
+	return condition, true, nil
+}
@@ -0,0 +1,264 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+const (
+	// IdempotencyKeyHeader is the header holding the key identifying the retries of a request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to `true` on the responses replayed from the IdempotencyStore
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// MaxIdempotencyKeyLength is the maximum length of an idempotency key
+	MaxIdempotencyKeyLength = 255
+	// idempotencyStoreTimeout bounds the release of a key or the save of its response, which are done even when the
+	// request has been cancelled
+	idempotencyStoreTimeout = 5 * time.Second
+)
+
+var (
+	// InvalidIdempotencyKeyMessage is the error message we return when the idempotency key is empty or too long
+	InvalidIdempotencyKeyMessage = NewErrorMessage("400006", "the idempotency key is invalid")
+	// IdempotencyRequestInProgressMessage is the error message we return when a request with the same idempotency key
+	// is still being processed
+	IdempotencyRequestInProgressMessage = NewErrorMessage("409002", "a request with the same idempotency key is in progress")
+	// IdempotencyKeyReusedMessage is the error message we return when an idempotency key is reused for another request
+	IdempotencyKeyReusedMessage = NewErrorMessage("422002", "the idempotency key has already been used for another request")
+)
+
+// NewErrInvalidIdempotencyKey is returned when the idempotency key is empty or longer than MaxIdempotencyKeyLength
+func NewErrInvalidIdempotencyKey() error {
+	return &Error{
+		HTTPCode:     http.StatusBadRequest,
+		ErrorMessage: InvalidIdempotencyKeyMessage,
+		Details:      ErrorDetails{IdempotencyKeyHeader: fmt.Sprintf("must be between 1 and %d characters long", MaxIdempotencyKeyLength)},
+	}
+}
+
+// NewErrIdempotencyRequestInProgress is returned when a request with the same idempotency key is still being processed
+func NewErrIdempotencyRequestInProgress() error {
+	return &Error{
+		HTTPCode:     http.StatusConflict,
+		ErrorMessage: IdempotencyRequestInProgressMessage,
+	}
+}
+
+// NewErrIdempotencyKeyReused is returned when an idempotency key is reused with another method, path or body
+func NewErrIdempotencyKeyReused() error {
+	return &Error{
+		HTTPCode:     http.StatusUnprocessableEntity,
+		ErrorMessage: IdempotencyKeyReusedMessage,
+	}
+}
+
+// IdempotentResponse is the response captured for an idempotency key
+type IdempotentResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyRecord is what an IdempotencyStore knows about an idempotency key. Response is nil while the first
+// request is in flight.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Response    *IdempotentResponse
+}
+
+// IdempotencyStore keeps the idempotency keys and the responses of their requests
+type IdempotencyStore interface {
+	// Reserve records the key for the request with the fingerprint and returns nil, or returns the existing record when
+	// the key is already known
+	Reserve(ctx context.Context, key string, fingerprint string) (*IdempotencyRecord, error)
+	// Save records the response of the request which reserved the key
+	Save(ctx context.Context, key string, response IdempotentResponse) error
+	// Release forgets a key whose request failed so that it can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyScopeFunc identifies the client a request is made for, e.g. its authenticated subject, so that the
+// idempotency keys of different clients never collide. Requests with an empty scope share the keys of all the clients.
+type IdempotencyScopeFunc func(r *http.Request, params map[string]string) string
+
+// IdempotencyScopeByHeader scopes the idempotency keys by a request header such as the `Authorization` header. The
+// header is hashed before reaching the store.
+func IdempotencyScopeByHeader(name string) IdempotencyScopeFunc {
+	return func(r *http.Request, _ map[string]string) string {
+		return r.Header.Get(name)
+	}
+}
+
+// IdempotencyMiddleware honours the IdempotencyKeyHeader of the requests with an unsafe method. The keys are scoped
+// by the scope function, which should identify the authenticated client: without it, a client reusing the key of
+// another one would get the response of the other client replayed. A nil scope function makes the keys global.
+// The first request with a key is handled and its response is saved in the store, the retries get the saved status,
+// headers and body back. A retry arriving while the first request is in flight is rejected with a 409 and a key reused
+// for a request with another method, path or body is rejected with a 422. When the handler returns an error or
+// responds with a server error, the key is released so that the request can be retried.
+func IdempotencyMiddleware(store IdempotencyStore, scope IdempotencyScopeFunc) Middleware {
+	return func(before Handler) Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			key, ok := r.Header[http.CanonicalHeaderKey(IdempotencyKeyHeader)]
+			if !ok || isSafeMethod(r.Method) {
+				return before(ctx, w, r, params)
+			}
+
+			ctx, span := trace.StartSpan(ctx, "internal.web.Idempotency")
+			defer span.End()
+
+			if len(key[0]) == 0 || len(key[0]) > MaxIdempotencyKeyLength {
+				return fmt.Errorf("%w", NewErrInvalidIdempotencyKey())
+			}
+
+			fingerprint, err := requestFingerprint(r)
+			if err != nil {
+				return err
+			}
+
+			storeKey := key[0]
+			if scope != nil {
+				storeKey = scopedIdempotencyKey(scope(r, params), storeKey)
+			}
+
+			record, err := store.Reserve(ctx, storeKey, fingerprint)
+			if err != nil {
+				return fmt.Errorf("can't reserve the idempotency key: %v", err)
+			}
+
+			if record != nil {
+				switch {
+				case record.Fingerprint != fingerprint:
+					return fmt.Errorf("%w", NewErrIdempotencyKeyReused())
+				case record.Response == nil:
+					return fmt.Errorf("%w", NewErrIdempotencyRequestInProgress())
+				default:
+					return replayResponse(ctx, w, *record.Response)
+				}
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			if err := before(ctx, recorder, r, params); err != nil || recorder.statusCode >= http.StatusInternalServerError {
+				// the key is released even when the request has been cancelled, or it would stay reserved until it expires
+				releaseCtx, cancel := context.WithTimeout(trace.NewContext(context.Background(), span), idempotencyStoreTimeout)
+				defer cancel()
+
+				if releaseErr := store.Release(releaseCtx, storeKey); releaseErr != nil {
+					span.AddAttributes(trace.StringAttribute("idempotency-release-error", releaseErr.Error()))
+				}
+
+				return err
+			}
+
+			response := IdempotentResponse{
+				StatusCode: recorder.statusCode,
+				Header:     w.Header().Clone(),
+				Body:       recorder.body.Bytes(),
+			}
+
+			// the response is saved even when the client is gone, or its retries would run the handler again once the
+			// reservation of the key lapses
+			saveCtx, cancel := context.WithTimeout(trace.NewContext(context.Background(), span), idempotencyStoreTimeout)
+			defer cancel()
+
+			if err := store.Save(saveCtx, storeKey, response); err != nil {
+				// the response is already sent: the retries get a 409 until the reservation of the key lapses in the
+				// store, then the handler runs again
+				span.AddAttributes(trace.StringAttribute("idempotency-save-error", err.Error()))
+			}
+
+			return nil
+		}
+
+		return h
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions || method == http.MethodTrace
+}
+
+// scopedIdempotencyKey prefixes the key with the hash of the scope, which keeps the scopes apart whatever their content
+// and keeps credentials used as scopes out of the store
+func scopedIdempotencyKey(scope string, key string) string {
+	if scope == "" {
+		return key
+	}
+
+	hash := sha256.Sum256([]byte(scope))
+
+	return hex.EncodeToString(hash[:]) + ":" + key
+}
+
+// requestFingerprint hashes the method, path and body of the request. The body is read and replaced so that the
+// handler can read it again.
+func requestFingerprint(r *http.Request) (string, error) {
+	var body []byte
+
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return "", fmt.Errorf("can't read the request body: %v", err)
+		}
+
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func replayResponse(ctx context.Context, w http.ResponseWriter, response IdempotentResponse) error {
+	if v, ok := ctx.Value(KeyValues).(*Values); ok {
+		v.StatusCode = response.StatusCode
+	}
+
+	// the headers already set for this request, such as its trace ID, are kept
+	for name, values := range response.Header {
+		if _, ok := w.Header()[name]; !ok {
+			w.Header()[name] = values
+		}
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+
+	w.WriteHeader(response.StatusCode)
+	_, err := w.Write(response.Body)
+
+	return err
+}
+
+// responseRecorder captures the response sent to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (recorder *responseRecorder) WriteHeader(statusCode int) {
+	if !recorder.wroteHeader {
+		recorder.statusCode = statusCode
+		recorder.wroteHeader = true
+	}
+
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (recorder *responseRecorder) Write(data []byte) (int, error) {
+	recorder.wroteHeader = true
+	recorder.body.Write(data)
+
+	return recorder.ResponseWriter.Write(data)
+}
@@ -34,6 +34,13 @@ var (
 			TagKeys:     []metrics.TagKey{metricTagResponseCode},
 			Aggregation: metrics.ViewCount(),
 		},
+		{
+			Name:        "http/rate_limited",
+			Measure:     metricRateLimitedTotal,
+			Description: "The number of requests rejected by a rate limit",
+			TagKeys:     []metrics.TagKey{metricTagRateLimit},
+			Aggregation: metrics.ViewCount(),
+		},
 	}
 )
 
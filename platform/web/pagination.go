@@ -0,0 +1,101 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	// DefaultPageLimit is the number of items of a page when the request does not define a limit
+	DefaultPageLimit = 20
+	// MaxPageLimit is the maximum number of items a request can ask for
+	MaxPageLimit = 100
+)
+
+// InvalidPaginationMessage is the error message we return when the pagination parameters are invalid
+var InvalidPaginationMessage = NewErrorMessage("400004", "the pagination parameters are invalid")
+
+// PageRequest represents the pagination parameters of a request
+type PageRequest struct {
+	Cursor string
+	Limit  int
+}
+
+// Pagination is the pagination part of a page envelope
+type Pagination struct {
+	Limit    int    `json:"limit"`
+	Next     string `json:"next,omitempty"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// PageEnvelope is the consistent JSON response of every paginated endpoint
+type PageEnvelope struct {
+	Data       interface{} `json:"data"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// NewErrInvalidPagination is returned when the `cursor` or `limit` parameters are invalid
+func NewErrInvalidPagination(details ErrorDetails) error {
+	return &Error{
+		HTTPCode:     http.StatusBadRequest,
+		ErrorMessage: InvalidPaginationMessage,
+		Details:      details,
+	}
+}
+
+// ParsePageRequest reads the `cursor` and `limit` parameters of a handler. The limit defaults to DefaultPageLimit and
+// can't exceed MaxPageLimit.
+func ParsePageRequest(params map[string]string) (PageRequest, error) {
+	request := PageRequest{
+		Cursor: params["cursor"],
+		Limit:  DefaultPageLimit,
+	}
+
+	if rawLimit, ok := params["limit"]; ok {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 || limit > MaxPageLimit {
+			return request, fmt.Errorf("%w", NewErrInvalidPagination(ErrorDetails{
+				"limit": fmt.Sprintf("must be an integer between 1 and %d", MaxPageLimit),
+			}))
+		}
+
+		request.Limit = limit
+	}
+
+	return request, nil
+}
+
+// RespondPage sends the items of a page wrapped in a PageEnvelope. It also sets the `Link` header with the URLs of the
+// next and previous pages, built from the URL of the request.
+func RespondPage(ctx context.Context, w http.ResponseWriter, r *http.Request, items interface{}, pagination Pagination) error {
+	var links []string
+
+	if pagination.Next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(r, pagination.Next, pagination.Limit)))
+	}
+
+	if pagination.Previous != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(r, pagination.Previous, pagination.Limit)))
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	return Respond(ctx, w, PageEnvelope{Data: items, Pagination: pagination}, http.StatusOK)
+}
+
+func pageURL(r *http.Request, cursor string, limit int) string {
+	pageURL := url.URL{Path: r.URL.Path}
+
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	query.Set("limit", strconv.Itoa(limit))
+	pageURL.RawQuery = query.Encode()
+
+	return pageURL.String()
+}
@@ -0,0 +1,285 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.opencensus.io/trace"
+
+	"github.com/fewlinesco/go-pkg/platform/metrics"
+)
+
+// TooManyRequestsMessage is the error message we return when a client exceeded its rate limit
+var TooManyRequestsMessage = NewErrorMessage("429000", "too many requests, retry later")
+
+var (
+	metricRateLimitedTotal = metrics.Float64("http_rate_limited_total", "The total of requests rejected by a rate limit", metrics.UnitDimensionless)
+
+	metricTagRateLimit = metrics.MustNewTagKey("http/rate_limit")
+)
+
+// NewErrTooManyRequests is returned when a client exceeded its rate limit
+func NewErrTooManyRequests() error {
+	return &Error{
+		HTTPCode:     http.StatusTooManyRequests,
+		ErrorMessage: TooManyRequestsMessage,
+	}
+}
+
+// RateLimit allows Requests per Period to each client. It is enforced with a token bucket of Requests tokens refilled
+// over the Period so that a client can burst up to Requests requests and is then allowed one request every
+// Period / Requests.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Validate checks the rate limit allows at least one request over a period
+func (limit RateLimit) Validate() error {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		return fmt.Errorf("invalid rate limit of %d requests per %s", limit.Requests, limit.Period)
+	}
+
+	return nil
+}
+
+func (limit RateLimit) refillRate() float64 {
+	return float64(limit.Requests) / limit.Period.Seconds()
+}
+
+// RateLimitResult is the outcome of a request against its rate limit. Reset is the time left before the bucket is
+// full again and RetryAfter the time left before the next request is allowed, 0 when it is.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// TokenBucket is the state of a client against its rate limit, kept by the RateLimitStore
+type TokenBucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// NewTokenBucket returns the full bucket of a client seen for the first time
+func NewTokenBucket(limit RateLimit, now time.Time) TokenBucket {
+	return TokenBucket{Tokens: float64(limit.Requests), UpdatedAt: now}
+}
+
+// Take refills the bucket for the time elapsed since it was updated and takes a token from it when there is one left.
+// It returns the updated bucket to store.
+func (bucket TokenBucket) Take(limit RateLimit, now time.Time) (TokenBucket, RateLimitResult) {
+	rate := limit.refillRate()
+
+	if elapsed := now.Sub(bucket.UpdatedAt); elapsed > 0 {
+		bucket.Tokens = math.Min(float64(limit.Requests), bucket.Tokens+elapsed.Seconds()*rate)
+		bucket.UpdatedAt = now
+	}
+
+	result := RateLimitResult{Limit: limit.Requests}
+
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.Tokens) / rate * float64(time.Second))
+	}
+
+	result.Remaining = int(bucket.Tokens)
+	result.Reset = time.Duration((float64(limit.Requests) - bucket.Tokens) / rate * float64(time.Second))
+
+	return bucket, result
+}
+
+// RateLimitStore keeps the token buckets of the clients
+type RateLimitStore interface {
+	// Take takes a token from the bucket of the key
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// RateLimitKeyFunc identifies the client of a request, e.g. by its IP address or API key. Requests with an empty key are
+// not limited.
+type RateLimitKeyFunc func(r *http.Request, params map[string]string) string
+
+// RateLimitByIP identifies the clients by the IP address the requests come from. Behind a load balancer or an ingress
+// it is the address of the proxy, which all the clients share: use RateLimitByForwardedIP instead.
+func RateLimitByIP(r *http.Request, _ map[string]string) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// RateLimitByForwardedIP identifies the clients by their IP address behind the trusted proxies. The X-Forwarded-For
+// header is read from the right and the first address which is not a trusted proxy is the client: the addresses on
+// its left are written by the client itself and can't be trusted. Requests which do not come from a trusted proxy are
+// identified by their remote address.
+func RateLimitByForwardedIP(trustedProxies ...*net.IPNet) RateLimitKeyFunc {
+	trusted := func(address string) bool {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return false
+		}
+
+		for _, proxy := range trustedProxies {
+			if proxy.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return func(r *http.Request, params map[string]string) string {
+		client := RateLimitByIP(r, params)
+		if !trusted(client) {
+			return client
+		}
+
+		var forwarded []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			forwarded = append(forwarded, splitHeaderValues(value)...)
+		}
+
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			client = forwarded[i]
+			if !trusted(client) {
+				return client
+			}
+		}
+
+		return client
+	}
+}
+
+// RateLimitByHeader identifies the clients by a request header such as an API key. Requests without the header are not
+// limited and should be limited by another key if needed.
+func RateLimitByHeader(name string) RateLimitKeyFunc {
+	return func(r *http.Request, _ map[string]string) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RateLimitByRoute limits the requests to a route as a whole, whoever the client
+func RateLimitByRoute(r *http.Request, _ map[string]string) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + template
+		}
+	}
+
+	return r.Method + " " + r.URL.Path
+}
+
+// RateLimitMiddleware limits the requests of each client, identified by the key function. The name identifies the rate
+// limit in the store and in the metrics so that several rate limits can share a store. Every limited response carries
+// the `RateLimit-Limit`, `RateLimit-Remaining` and `RateLimit-Reset` headers and the throttled requests are rejected
+// with a 429 and a `Retry-After` header. Requests are let through when the store fails so that the rate limit never
+// takes the service down.
+func RateLimitMiddleware(name string, store RateLimitStore, limit RateLimit, key RateLimitKeyFunc) Middleware {
+	return func(before Handler) Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			client := key(r, params)
+			if client == "" {
+				return before(ctx, w, r, params)
+			}
+
+			ctx, span := trace.StartSpan(ctx, "internal.web.RateLimit")
+			result, err := store.Take(ctx, name+":"+client, limit)
+			if err != nil {
+				span.AddAttributes(trace.StringAttribute("rate-limit-error", err.Error()))
+				span.End()
+
+				return before(ctx, w, r, params)
+			}
+			span.End()
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				metrics.RecordWithTags(ctx, []metrics.Tag{{Key: metricTagRateLimit, Value: name}}, metricRateLimitedTotal.Measure(1))
+
+				return fmt.Errorf("%w", NewErrTooManyRequests())
+			}
+
+			return before(ctx, w, r, params)
+		}
+
+		return h
+	}
+}
+
+func ceilSeconds(duration time.Duration) int {
+	return int(math.Ceil(duration.Seconds()))
+}
+
+// MemoryRateLimitStore keeps the token buckets in memory, which limits the requests of each instance of a service
+// independently. The buckets which are full again are dropped periodically.
+type MemoryRateLimitStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]memoryTokenBucket
+	lastSweep time.Time
+}
+
+type memoryTokenBucket struct {
+	TokenBucket
+	full time.Time
+}
+
+// memoryRateLimitSweepInterval is the minimum time between two sweeps of the full buckets
+const memoryRateLimitSweepInterval = time.Minute
+
+// NewMemoryRateLimitStore returns an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]memoryTokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take takes a token from the bucket of the key
+func (store *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	if err := limit.Validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(store.lastSweep) > memoryRateLimitSweepInterval {
+		for bucketKey, bucket := range store.buckets {
+			if !now.Before(bucket.full) {
+				delete(store.buckets, bucketKey)
+			}
+		}
+
+		store.lastSweep = now
+	}
+
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket.TokenBucket = NewTokenBucket(limit, now)
+	}
+
+	var result RateLimitResult
+	bucket.TokenBucket, result = bucket.Take(limit, now)
+	bucket.full = now.Add(result.Reset)
+	store.buckets[key] = bucket
+
+	return result, nil
+}
@@ -26,9 +26,15 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 }
 
 // RespondError is a helper function in charge of sending back a JSON response to the client based on an error.
-// The error needs to be a wrapper around a web.Error, otherwise it will generate a 500 with a default message.
+// The error needs to be a wrapper around a web.Error or to be converted by a registered ErrorTranslator, otherwise it
+// will generate a 500 with a default message.
 func RespondError(ctx context.Context, w http.ResponseWriter, err error) error {
 	webErr, ok := errors.Unwrap(err).(*Error)
+	if !ok {
+		webErr = translateError(err)
+		ok = webErr != nil
+	}
+
 	if !ok {
 		v := ctx.Value(KeyValues).(*Values)
 
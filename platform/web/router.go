@@ -24,6 +24,9 @@ type ctxKey int
 // in the application context
 const KeyValues ctxKey = 1
 
+// keyPreflightRoute holds the preflightRoute answering an OPTIONS request, the CORSMiddleware reads its methods
+const keyPreflightRoute ctxKey = 2
+
 // Values represents all the web values stored in the context
 type Values struct {
 	TraceID    string
@@ -52,6 +55,7 @@ func NewRouter(logger *logging.Logger, middlewares []Middleware) *Router {
 		Router:      mux.NewRouter(),
 		logger:      logger,
 		middlewares: middlewares,
+		preflights:  make(map[string]*preflightRoute),
 	}
 
 	app.Router.NotFoundHandler = app.defineHandler(func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
@@ -76,11 +80,41 @@ type Router struct {
 	middlewares []Middleware
 	och         *ochttp.Handler
 	shutdown    chan os.Signal
+	preflights  map[string]*preflightRoute
 }
 
 // HandleFunc is a way to add a new router to the router. The middlewares will be added to the default middlewares set on the server. It's not a replacement.
+// Unless an OPTIONS handler is registered for the path, OPTIONS requests are answered with the registered methods after
+// going through the default middlewares of the router, so that a CORSMiddleware answers the preflight requests.
 func (a *Router) HandleFunc(method string, path string, handler Handler, middlewares ...Middleware) {
-	a.Router.HandleFunc(path, a.defineHandler(handler, middlewares...)).Methods(method)
+	route := a.Router.HandleFunc(path, a.defineHandler(handler, middlewares...)).Methods(method)
+
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return
+	}
+
+	preflight, ok := a.preflights[template]
+	if !ok {
+		preflight = &preflightRoute{}
+		a.preflights[template] = preflight
+
+		handler := a.defineHandler(preflight.handle)
+		preflightHandler := func(w http.ResponseWriter, r *http.Request) {
+			handler(w, r.WithContext(context.WithValue(r.Context(), keyPreflightRoute, preflight)))
+		}
+
+		a.Router.HandleFunc(path, preflightHandler).Methods(http.MethodOptions).MatcherFunc(func(*http.Request, *mux.RouteMatch) bool {
+			return !preflight.explicit
+		})
+	}
+
+	if method == http.MethodOptions {
+		preflight.explicit = true
+		return
+	}
+
+	preflight.methods = append(preflight.methods, method)
 }
 
 func (a *Router) defineHandler(handler Handler, middlewares ...Middleware) http.HandlerFunc {
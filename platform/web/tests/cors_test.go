@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/logging"
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestCORS(t *testing.T) {
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		return web.Respond(ctx, w, map[string]string{"status": "ok"}, http.StatusOK)
+	}
+
+	router := web.NewRouter(logging.NewTestLogger(t), []web.Middleware{
+		web.ErrorsMiddleware(),
+		web.CORSMiddleware(web.CORSPolicy{
+			AllowedOrigins:   []string{"https://*.example.com"},
+			AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+			AllowedHeaders:   []string{"Content-Type", "Authorization"},
+			ExposedHeaders:   []string{"ETag"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		}),
+	})
+	router.HandleFunc(http.MethodGet, "/orders/{id}", handler)
+	router.HandleFunc(http.MethodDelete, "/orders/{id}", handler)
+
+	public := router.NewSubRouter("/public", web.CORSMiddleware(web.CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	public.HandleFunc(http.MethodGet, "/products", handler)
+
+	serve := func(method string, path string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w
+	}
+
+	tcs := []struct {
+		name            string
+		method          string
+		path            string
+		headers         map[string]string
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "when a preflight request is allowed",
+			method:         http.MethodOptions,
+			path:           "/orders/1",
+			headers:        map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE", "Access-Control-Request-Headers": "authorization"},
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Methods":     "GET, DELETE",
+				"Access-Control-Allow-Headers":     "authorization",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+				"Allow":                            "GET, DELETE, OPTIONS",
+			},
+		},
+		{
+			name:            "when a preflight request comes from another origin",
+			method:          http.MethodOptions,
+			path:            "/orders/1",
+			headers:         map[string]string{"Origin": "https://example.org", "Access-Control-Request-Method": "GET"},
+			expectedStatus:  http.StatusNoContent,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:            "when a preflight request asks for a method which is not registered for the route",
+			method:          http.MethodOptions,
+			path:            "/orders/1",
+			headers:         map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			expectedStatus:  http.StatusNoContent,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:            "when a preflight request asks for a header which is not allowed",
+			method:          http.MethodOptions,
+			path:            "/orders/1",
+			headers:         map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Debug"},
+			expectedStatus:  http.StatusNoContent,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:           "when a cross-origin request is allowed",
+			method:         http.MethodGet,
+			path:           "/orders/1",
+			headers:        map[string]string{"Origin": "https://app.example.com"},
+			expectedStatus: http.StatusOK,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": "ETag",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:            "when the request is not cross-origin",
+			method:          http.MethodGet,
+			path:            "/orders/1",
+			expectedStatus:  http.StatusOK,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:           "when the sub router policy allows every origin",
+			method:         http.MethodOptions,
+			path:           "/public/products",
+			headers:        map[string]string{"Origin": "https://example.org", "Access-Control-Request-Method": "GET"},
+			expectedStatus: http.StatusNoContent,
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Allow":                            "GET, OPTIONS",
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(tc.method, tc.path, tc.headers)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("expected the status %d but got %d", tc.expectedStatus, w.Code)
+			}
+
+			for name, expected := range tc.expectedHeaders {
+				if value := w.Header().Get(name); value != expected {
+					t.Fatalf("expected the header %s to be %q but got %q", name, expected, value)
+				}
+			}
+		})
+	}
+
+	t.Run("it keeps the OPTIONS handlers registered by the application", func(t *testing.T) {
+		router.HandleFunc(http.MethodOptions, "/orders/{id}", func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+			return web.Respond(ctx, w, nil, http.StatusAccepted)
+		})
+
+		if w := serve(http.MethodOptions, "/orders/1", nil); w.Code != http.StatusAccepted {
+			t.Fatalf("expected the application handler to answer but got %d", w.Code)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tcs := []struct {
+		name              string
+		header            string
+		expectedCondition web.IfMatch
+		expectedOK        bool
+		expectedError     bool
+	}{
+		{
+			name: "when the header is missing",
+		},
+		{
+			name:              "when the header is an entity tag built by ETag",
+			header:            web.ETag(3),
+			expectedCondition: web.IfMatch{Versions: []int64{3}},
+			expectedOK:        true,
+		},
+		{
+			name:              "when the header matches any version",
+			header:            "*",
+			expectedCondition: web.IfMatch{Any: true},
+			expectedOK:        true,
+		},
+		{
+			name:              "when the header is a list of entity tags",
+			header:            `"1", "2",W/"3", "abc"`,
+			expectedCondition: web.IfMatch{Versions: []int64{1, 2}},
+			expectedOK:        true,
+		},
+		{
+			name:          "when the header is a weak entity tag",
+			header:        `W/"3"`,
+			expectedOK:    true,
+			expectedError: true,
+		},
+		{
+			name:          "when the header is not a version",
+			header:        `"abc"`,
+			expectedOK:    true,
+			expectedError: true,
+		},
+		{
+			name:          "when the header is not a list of entity tags",
+			header:        `"1", 2`,
+			expectedOK:    true,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/", nil)
+			if tc.header != "" {
+				r.Header.Set("If-Match", tc.header)
+			}
+
+			condition, ok, err := web.ParseIfMatch(r)
+			if tc.expectedError {
+				var webErr *web.Error
+				if !errors.As(err, &webErr) || webErr.HTTPCode != http.StatusPreconditionFailed {
+					t.Fatalf("expected a precondition failed error but got: %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if ok != tc.expectedOK || !reflect.DeepEqual(condition, tc.expectedCondition) {
+				t.Fatalf("expected the condition %#v (%v) but got %#v (%v)", tc.expectedCondition, tc.expectedOK, condition, ok)
+			}
+		})
+	}
+}
+
+func TestIfMatchMatches(t *testing.T) {
+	if !(web.IfMatch{Any: true}).Matches(7) {
+		t.Fatalf("expected * to match any version")
+	}
+
+	list := web.IfMatch{Versions: []int64{1, 2}}
+	if !list.Matches(2) || list.Matches(3) {
+		t.Fatalf("expected a list to match its versions only")
+	}
+}
+
+func TestSetETag(t *testing.T) {
+	w := httptest.NewRecorder()
+	web.SetETag(w, 42)
+
+	if etag := w.Header().Get("ETag"); etag != `"42"` {
+		t.Fatalf(`expected the ETag header to be "42" but got %s`, etag)
+	}
+}
@@ -0,0 +1,269 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+type memoryIdempotencyStore struct {
+	mutex   sync.Mutex
+	records map[string]*web.IdempotencyRecord
+}
+
+func (store *memoryIdempotencyStore) Reserve(_ context.Context, key string, fingerprint string) (*web.IdempotencyRecord, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if record, ok := store.records[key]; ok {
+		return record, nil
+	}
+
+	store.records[key] = &web.IdempotencyRecord{Fingerprint: fingerprint}
+
+	return nil, nil
+}
+
+func (store *memoryIdempotencyStore) Save(ctx context.Context, key string, response web.IdempotentResponse) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.records[key].Response = &response
+
+	return nil
+}
+
+func (store *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.records, key)
+
+	return nil
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	store := &memoryIdempotencyStore{records: make(map[string]*web.IdempotencyRecord)}
+
+	var calls int
+	var disconnect context.CancelFunc
+	release := make(chan struct{})
+
+	handler := web.IdempotencyMiddleware(store, web.IdempotencyScopeByHeader("Authorization"))(func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		calls++
+
+		body, _ := io.ReadAll(r.Body)
+		if string(body) == "slow" {
+			<-release
+		}
+
+		if string(body) == "fail" {
+			return errors.New("failure")
+		}
+
+		if string(body) == "disconnect" {
+			err := web.Respond(ctx, w, map[string]int{"order": calls}, http.StatusCreated)
+			disconnect()
+
+			return err
+		}
+
+		return web.Respond(ctx, w, map[string]int{"order": calls}, http.StatusCreated)
+	})
+
+	serveAs := func(client string, method string, key string, body string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(method, "/orders", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(web.IdempotencyKeyHeader, key)
+		}
+
+		if client != "" {
+			r.Header.Set("Authorization", client)
+		}
+
+		w := httptest.NewRecorder()
+		ctx := context.WithValue(r.Context(), web.KeyValues, &web.Values{})
+
+		return w, handler(ctx, w, r, map[string]string{})
+	}
+
+	serve := func(method string, key string, body string) (*httptest.ResponseRecorder, error) {
+		return serveAs("", method, key, body)
+	}
+
+	assertError := func(t *testing.T, err error, expectedCode int) {
+		var webErr *web.Error
+		if !errors.As(err, &webErr) || webErr.HTTPCode != expectedCode {
+			t.Fatalf("expected an error with the status %d but got: %v", expectedCode, err)
+		}
+	}
+
+	t.Run("it replays the response of a retry", func(t *testing.T) {
+		first, err := serve(http.MethodPost, "order-1", `{"item":1}`)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		retry, err := serve(http.MethodPost, "order-1", `{"item":1}`)
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		if calls != 1 {
+			t.Fatalf("expected the handler to be called once but it was called %d times", calls)
+		}
+
+		if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get(web.IdempotentReplayedHeader) != "true" {
+			t.Fatalf("expected the first response to be replayed but got %d %s", retry.Code, retry.Body.String())
+		}
+	})
+
+	t.Run("it does not replay the response of another client", func(t *testing.T) {
+		before := calls
+
+		for _, client := range []string{"Bearer alice", "Bearer bob"} {
+			w, err := serveAs(client, http.MethodPost, "order-1", `{"item":1}`)
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if w.Header().Get(web.IdempotentReplayedHeader) != "" {
+				t.Fatalf("expected the response of %s not to be replayed", client)
+			}
+		}
+
+		if calls != before+2 {
+			t.Fatalf("expected the handler to be called for each client")
+		}
+
+		for key := range store.records {
+			if strings.Contains(key, "alice") || strings.Contains(key, "bob") {
+				t.Fatalf("expected the scope to be hashed but got the key %s", key)
+			}
+		}
+	})
+
+	t.Run("it rejects a key reused with another payload", func(t *testing.T) {
+		_, err := serve(http.MethodPost, "order-1", `{"item":2}`)
+		assertError(t, err, http.StatusUnprocessableEntity)
+	})
+
+	t.Run("it rejects a retry while the first request is in flight", func(t *testing.T) {
+		done := make(chan error)
+
+		go func() {
+			_, err := serve(http.MethodPost, "order-2", "slow")
+			done <- err
+		}()
+
+		for {
+			store.mutex.Lock()
+			_, reserved := store.records["order-2"]
+			store.mutex.Unlock()
+
+			if reserved {
+				break
+			}
+		}
+
+		_, err := serve(http.MethodPost, "order-2", "slow")
+		assertError(t, err, http.StatusConflict)
+
+		close(release)
+
+		if err := <-done; err != nil {
+			t.Fatalf("expected the first request to succeed but got: %v", err)
+		}
+	})
+
+	t.Run("it releases the key of a failed request", func(t *testing.T) {
+		if _, err := serve(http.MethodPost, "order-3", "fail"); err == nil {
+			t.Fatalf("expected the handler error")
+		}
+
+		if _, ok := store.records["order-3"]; ok {
+			t.Fatalf("expected the key to be released")
+		}
+	})
+
+	t.Run("it releases the key of a cancelled request", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("fail"))
+		r.Header.Set(web.IdempotencyKeyHeader, "order-5")
+
+		ctx, cancel := context.WithCancel(context.WithValue(r.Context(), web.KeyValues, &web.Values{}))
+		cancel()
+
+		if err := handler(ctx, httptest.NewRecorder(), r, map[string]string{}); err == nil {
+			t.Fatalf("expected the handler error")
+		}
+
+		if _, ok := store.records["order-5"]; ok {
+			t.Fatalf("expected the key to be released")
+		}
+	})
+
+	t.Run("it replays the response of a request whose client disconnected", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader("disconnect"))
+		r.Header.Set(web.IdempotencyKeyHeader, "order-6")
+
+		var ctx context.Context
+		ctx, disconnect = context.WithCancel(context.WithValue(r.Context(), web.KeyValues, &web.Values{}))
+		defer disconnect()
+
+		first := httptest.NewRecorder()
+		if err := handler(ctx, first, r, map[string]string{}); err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		before := calls
+
+		retry, err := serve(http.MethodPost, "order-6", "disconnect")
+		if err != nil {
+			t.Fatalf("expected no error but got: %v", err)
+		}
+
+		if calls != before {
+			t.Fatalf("expected the handler not to be called for the retry")
+		}
+
+		if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get(web.IdempotentReplayedHeader) != "true" {
+			t.Fatalf("expected the first response to be replayed but got %d %s", retry.Code, retry.Body.String())
+		}
+	})
+
+	t.Run("it rejects an empty key", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+		r.Header[web.IdempotencyKeyHeader] = []string{""}
+
+		err := handler(context.Background(), httptest.NewRecorder(), r, map[string]string{})
+		assertError(t, err, http.StatusBadRequest)
+	})
+
+	t.Run("it ignores the safe methods", func(t *testing.T) {
+		before := calls
+		for i := 0; i < 2; i++ {
+			if _, err := serve(http.MethodGet, "order-4", ""); err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+		}
+
+		if calls != before+2 {
+			t.Fatalf("expected the handler to be called for every request")
+		}
+	})
+}
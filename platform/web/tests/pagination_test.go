@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestParsePageRequest(t *testing.T) {
+	tcs := []struct {
+		name          string
+		params        map[string]string
+		expected      web.PageRequest
+		expectedError bool
+	}{
+		{
+			name:     "when no parameter is given it uses the default limit",
+			params:   map[string]string{},
+			expected: web.PageRequest{Limit: web.DefaultPageLimit},
+		},
+		{
+			name:     "when a cursor and a limit are given",
+			params:   map[string]string{"cursor": "abc", "limit": "5"},
+			expected: web.PageRequest{Cursor: "abc", Limit: 5},
+		},
+		{
+			name:          "when the limit is not a number",
+			params:        map[string]string{"limit": "five"},
+			expectedError: true,
+		},
+		{
+			name:          "when the limit is too large",
+			params:        map[string]string{"limit": "1000"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			request, err := web.ParsePageRequest(tc.params)
+
+			if tc.expectedError {
+				var webErr *web.Error
+				if !errors.As(err, &webErr) || webErr.HTTPCode != http.StatusBadRequest {
+					t.Fatalf("expected a bad request error but got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if request != tc.expected {
+				t.Fatalf("expected %#v but got %#v", tc.expected, request)
+			}
+		})
+	}
+}
+
+func TestRespondPage(t *testing.T) {
+	ctx := context.WithValue(context.Background(), web.KeyValues, &web.Values{})
+	request := httptest.NewRequest(http.MethodGet, "/items?status=active&cursor=current", nil)
+	recorder := httptest.NewRecorder()
+
+	err := web.RespondPage(ctx, recorder, request, []string{"a", "b"}, web.Pagination{Limit: 2, Next: "next-cursor", Previous: "previous-cursor"})
+	if err != nil {
+		t.Fatalf("could not respond: %v", err)
+	}
+
+	link := recorder.Header().Get("Link")
+	if !strings.Contains(link, `</items?cursor=next-cursor&limit=2&status=active>; rel="next"`) || !strings.Contains(link, `rel="prev"`) {
+		t.Fatalf("unexpected Link header %q", link)
+	}
+
+	var envelope struct {
+		Data       []string       `json:"data"`
+		Pagination web.Pagination `json:"pagination"`
+	}
+
+	if err := json.NewDecoder(recorder.Body).Decode(&envelope); err != nil {
+		t.Fatalf("could not decode the response: %v", err)
+	}
+
+	if len(envelope.Data) != 2 || envelope.Pagination.Next != "next-cursor" {
+		t.Fatalf("unexpected envelope %#v", envelope)
+	}
+}
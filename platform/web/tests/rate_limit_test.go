@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fewlinesco/go-pkg/platform/web"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limit := web.RateLimit{Requests: 2, Period: 2 * time.Second}
+	now := time.Now()
+	bucket := web.NewTokenBucket(limit, now)
+
+	tcs := []struct {
+		name              string
+		elapsed           time.Duration
+		expectedAllowed   bool
+		expectedRemaining int
+		expectedRetry     time.Duration
+	}{
+		{name: "when the bucket is full", expectedAllowed: true, expectedRemaining: 1},
+		{name: "when a token is left", expectedAllowed: true, expectedRemaining: 0},
+		{name: "when the bucket is empty", expectedRetry: time.Second},
+		{name: "when a token has been refilled", elapsed: time.Second, expectedAllowed: true, expectedRemaining: 0},
+		{name: "when half a token has been refilled", elapsed: 500 * time.Millisecond, expectedRetry: 500 * time.Millisecond},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.elapsed)
+
+			var result web.RateLimitResult
+			bucket, result = bucket.Take(limit, now)
+
+			if result.Allowed != tc.expectedAllowed || result.Remaining != tc.expectedRemaining || result.RetryAfter != tc.expectedRetry {
+				t.Fatalf("expected allowed %t with %d remaining and a retry after %s but got %#v", tc.expectedAllowed, tc.expectedRemaining, tc.expectedRetry, result)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limit := web.RateLimit{Requests: 2, Period: time.Minute}
+	handler := web.RateLimitMiddleware("orders", web.NewMemoryRateLimitStore(), limit, web.RateLimitByIP)(func(ctx context.Context, w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+
+	serve := func(remoteAddr string) (*httptest.ResponseRecorder, error) {
+		r := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		r.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+
+		return w, handler(context.Background(), w, r, map[string]string{})
+	}
+
+	for i := 0; i < limit.Requests; i++ {
+		w, err := serve("192.0.2.1:1234")
+		if err != nil {
+			t.Fatalf("expected request %d to be allowed but got: %v", i, err)
+		}
+
+		if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") == "" || w.Header().Get("RateLimit-Reset") == "" {
+			t.Fatalf("expected the rate limit headers but got %v", w.Header())
+		}
+	}
+
+	w, err := serve("192.0.2.1:4321")
+
+	var webErr *web.Error
+	if !errors.As(err, &webErr) || webErr.HTTPCode != http.StatusTooManyRequests || webErr.Code != web.TooManyRequestsMessage.Code {
+		t.Fatalf("expected a too many requests error but got: %v", err)
+	}
+
+	if w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("expected the client to retry after 30 seconds but got %v", w.Header())
+	}
+
+	if _, err := serve("192.0.2.2:1234"); err != nil {
+		t.Fatalf("expected another client to be allowed but got: %v", err)
+	}
+}
+
+func TestRateLimitByForwardedIP(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("could not parse the proxies network: %v", err)
+	}
+
+	key := web.RateLimitByForwardedIP(proxies)
+
+	tcs := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedKey  string
+	}{
+		{
+			name:         "when the request does not come from a trusted proxy",
+			remoteAddr:   "192.0.2.1:1234",
+			forwardedFor: []string{"198.51.100.1"},
+			expectedKey:  "192.0.2.1",
+		},
+		{
+			name:         "when the request comes through trusted proxies",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"198.51.100.1, 192.0.2.1", "10.0.0.2"},
+			expectedKey:  "192.0.2.1",
+		},
+		{
+			name:         "when every forwarded address is a trusted proxy",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"10.0.0.3, 10.0.0.2"},
+			expectedKey:  "10.0.0.3",
+		},
+		{
+			name:        "when a trusted proxy does not forward the client address",
+			remoteAddr:  "10.0.0.1:1234",
+			expectedKey: "10.0.0.1",
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			r.RemoteAddr = tc.remoteAddr
+			for _, value := range tc.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if client := key(r, map[string]string{}); client != tc.expectedKey {
+				t.Fatalf("expected the key %s but got %s", tc.expectedKey, client)
+			}
+		})
+	}
+}